@@ -0,0 +1,73 @@
+// Command devtoken signs a user JWT for local runs and prints it.
+//
+// With -key it signs RS256 with a PEM private key (dev/jwt/rs256.pem pairs
+// with dev/jwt/jwks.json); otherwise HS256 with JWT_HS256_SECRET. The dev
+// keys are public, never configure them outside a local setup.
+package main
+
+import (
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func main() {
+	userID := flag.Int64("user", 1, "user id, put into sub")
+	ttl := flag.Duration("ttl", time.Hour, "token lifetime")
+	keyFile := flag.String("key", "", "PEM RSA private key: sign RS256 instead of HS256")
+	kid := flag.String("kid", "dev-1", "kid header for RS256")
+	issuer := flag.String("iss", os.Getenv("JWT_ISSUER"), "iss claim")
+	audience := flag.String("aud", os.Getenv("JWT_AUDIENCE"), "aud claim")
+	flag.Parse()
+
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.FormatInt(*userID, 10),
+		Issuer:    *issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(*ttl)),
+	}
+	if *audience != "" {
+		claims.Audience = jwt.ClaimStrings{*audience}
+	}
+
+	var (
+		signed string
+		err    error
+	)
+	if *keyFile != "" {
+		var key *rsa.PrivateKey
+		key, err = loadRSAKey(*keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		t.Header["kid"] = *kid
+		signed, err = t.SignedString(key)
+	} else {
+		secret := os.Getenv("JWT_HS256_SECRET")
+		if secret == "" {
+			log.Fatal("set JWT_HS256_SECRET or pass -key")
+		}
+		signed, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(signed)
+}
+
+func loadRSAKey(path string) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseRSAPrivateKeyFromPEM(b)
+}
@@ -0,0 +1,58 @@
+package apikey
+
+import (
+	"slices"
+	"time"
+)
+
+// Права ключа
+const (
+	ScopeProductsWrite     = "products:write"
+	ScopeReservationsAdmin = "reservations:admin"
+	ScopeOutboxReplay      = "outbox:replay"
+	ScopeKeysAdmin         = "apikeys:admin"
+)
+
+// Scopes lists every scope a key may be given
+var Scopes = []string{
+	ScopeProductsWrite,
+	ScopeReservationsAdmin,
+	ScopeOutboxReplay,
+	ScopeKeysAdmin,
+}
+
+// Key is a stored API key; the secret itself is never stored or returned
+// after it is issued
+type Key struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Scopes      []string   `json:"scopes"`
+	RotatedFrom *int64     `json:"rotated_from,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+func (k *Key) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// Issued is a freshly created key with its secret, shown once
+type Issued struct {
+	Key
+	Secret string `json:"key"`
+}
+
+// AuditEntry is one call to a route protected by an API key
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	APIKeyID   *int64    `json:"api_key_id,omitempty"`
+	Scope      string    `json:"scope"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+}
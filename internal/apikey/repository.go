@@ -0,0 +1,206 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scopes читаются строкой: database/sql не сканирует TEXT[] в []string
+const keyColumns = `
+	id, name, prefix, array_to_string(scopes, ','), rotated_from,
+	created_at, expires_at, revoked_at, last_used_at
+`
+
+func scanKey(row rowScanner) (*Key, error) {
+	var (
+		k      Key
+		scopes string
+	)
+	if err := row.Scan(
+		&k.ID,
+		&k.Name,
+		&k.Prefix,
+		&scopes,
+		&k.RotatedFrom,
+		&k.CreatedAt,
+		&k.ExpiresAt,
+		&k.RevokedAt,
+		&k.LastUsedAt,
+	); err != nil {
+		return nil, err
+	}
+	k.Scopes = strings.Split(scopes, ",")
+
+	return &k, nil
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	name, prefix, hash string,
+	scopes []string,
+	expiresAt *time.Time,
+	rotatedFrom *int64,
+	now time.Time,
+) (*Key, error) {
+
+	query := `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, expires_at, rotated_from, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + keyColumns
+
+	return scanKey(tx.QueryRowContext(ctx, query, name, prefix, hash, scopes, expiresAt, rotatedFrom, now))
+}
+
+// Authenticate returns the live key with this hash and marks it used
+func (r *Repository) Authenticate(ctx context.Context, hash string, now time.Time) (*Key, error) {
+
+	query := `
+		UPDATE api_keys
+		SET last_used_at = $2
+		WHERE key_hash = $1
+		  AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > $2)
+		RETURNING ` + keyColumns
+
+	return scanKey(r.db.QueryRowContext(ctx, query, hash, now))
+}
+
+func (r *Repository) GetByIDForUpdate(ctx context.Context, tx *sql.Tx, id int64) (*Key, error) {
+
+	query := `
+		SELECT ` + keyColumns + `
+		FROM api_keys
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	return scanKey(tx.QueryRowContext(ctx, query, id))
+}
+
+// SuccessorTx returns the id of the key that replaced id on rotation
+func (r *Repository) SuccessorTx(ctx context.Context, tx *sql.Tx, id int64) (int64, error) {
+
+	query := `
+		SELECT id
+		FROM api_keys
+		WHERE rotated_from = $1
+	`
+
+	var successor int64
+	err := tx.QueryRowContext(ctx, query, id).Scan(&successor)
+	return successor, err
+}
+
+func (r *Repository) List(ctx context.Context) ([]Key, error) {
+
+	query := `
+		SELECT ` + keyColumns + `
+		FROM api_keys
+		ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []Key
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+
+	return keys, rows.Err()
+}
+
+// ExpireTx shortens the key's lifetime to at, keeping an earlier expiry
+func (r *Repository) ExpireTx(ctx context.Context, tx *sql.Tx, id int64, at time.Time) error {
+
+	query := `
+		UPDATE api_keys
+		SET expires_at = LEAST(COALESCE(expires_at, $2), $2)
+		WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, id, at)
+	return err
+}
+
+// Revoke marks the key revoked; a key revoked earlier keeps its time
+func (r *Repository) Revoke(ctx context.Context, id int64, now time.Time) (*Key, error) {
+
+	query := `
+		UPDATE api_keys
+		SET revoked_at = COALESCE(revoked_at, $2)
+		WHERE id = $1
+		RETURNING ` + keyColumns
+
+	return scanKey(r.db.QueryRowContext(ctx, query, id, now))
+}
+
+func (r *Repository) RecordAudit(ctx context.Context, e AuditEntry) error {
+
+	query := `
+		INSERT INTO admin_audit_log (api_key_id, scope, method, path, status, remote_addr, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err := r.db.ExecContext(ctx, query, e.APIKeyID, e.Scope, e.Method, e.Path, e.Status, e.RemoteAddr, e.CreatedAt)
+	return err
+}
+
+// ListAudit returns the newest entries first
+func (r *Repository) ListAudit(ctx context.Context, limit, offset int) ([]AuditEntry, error) {
+
+	query := `
+		SELECT id, api_key_id, scope, method, path, status, remote_addr, created_at
+		FROM admin_audit_log
+		ORDER BY id DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(
+			&e.ID,
+			&e.APIKeyID,
+			&e.Scope,
+			&e.Method,
+			&e.Path,
+			&e.Status,
+			&e.RemoteAddr,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,233 @@
+// Package apikey issues, checks, rotates and revokes the API keys that
+// protect admin and catalog routes, and keeps the audit log of their use.
+//
+// A key is "fsr_" + 32 random bytes in base64url. Only its SHA-256 is
+// stored, so a leaked database doesn't leak usable keys; the key is shown
+// once, when it is issued.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	keyPrefix = "fsr_"
+	// сколько первых символов ключа хранится открыто, для узнавания в списке
+	displayPrefixLen = len(keyPrefix) + 8
+	// MaxAuditLimit caps one page of the audit log
+	MaxAuditLimit = 100
+)
+
+var (
+	ErrUnauthenticated = errors.New("invalid api key")
+	ErrNotFound        = errors.New("api key not found")
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrAlreadyRotated  = errors.New("api key already rotated")
+)
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// Create issues a key with the given scopes; expiresAt nil — без срока
+func (s *Service) Create(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (*Issued, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+	// колонки api_keys — TIMESTAMP без зоны: все времена, которые туда
+	// пишутся и с которыми сравниваются, в UTC
+	now := time.Now().UTC()
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidInput)
+		}
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	issued, err := s.issueTx(ctx, tx, name, scopes, expiresAt, nil, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+// Authenticate returns the key for a raw secret if it is neither revoked
+// nor expired
+func (s *Service) Authenticate(ctx context.Context, raw string) (*Key, error) {
+	if !strings.HasPrefix(raw, keyPrefix) {
+		return nil, ErrUnauthenticated
+	}
+
+	k, err := s.repo.Authenticate(ctx, hashKey(raw), time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (s *Service) List(ctx context.Context) ([]Key, error) {
+	return s.repo.List(ctx)
+}
+
+// Rotate issues a replacement with the same name, scopes and expiry. The
+// old key keeps working for grace so clients can switch over; zero grace
+// revokes it at once. A key is rotated once: its expiry is already cut to
+// the grace period, so the next rotation goes from the replacement.
+func (s *Service) Rotate(ctx context.Context, id int64, grace time.Duration) (*Issued, error) {
+	if grace < 0 {
+		return nil, fmt.Errorf("%w: grace must be >= 0", ErrInvalidInput)
+	}
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	old, err := s.repo.GetByIDForUpdate(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if old.RevokedAt != nil || (old.ExpiresAt != nil && !old.ExpiresAt.After(now)) {
+		return nil, fmt.Errorf("%w: api key %d is revoked or expired, create a new one", ErrInvalidInput, id)
+	}
+
+	successor, err := s.repo.SuccessorTx(ctx, tx, old.ID)
+	if err == nil {
+		return nil, fmt.Errorf("%w: api key %d was replaced by %d, rotate that one", ErrAlreadyRotated, id, successor)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	issued, err := s.issueTx(ctx, tx, old.Name, old.Scopes, old.ExpiresAt, &old.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.ExpireTx(ctx, tx, old.ID, now.Add(grace)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+// Revoke disables the key at once; revoking twice is not an error
+func (s *Service) Revoke(ctx context.Context, id int64) (*Key, error) {
+	k, err := s.repo.Revoke(ctx, id, time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	return k, err
+}
+
+func (s *Service) RecordAudit(ctx context.Context, e AuditEntry) error {
+	return s.repo.RecordAudit(ctx, e)
+}
+
+func (s *Service) ListAudit(ctx context.Context, limit, offset int) ([]AuditEntry, error) {
+	if limit <= 0 || limit > MaxAuditLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidInput, MaxAuditLimit)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must be >= 0", ErrInvalidInput)
+	}
+	return s.repo.ListAudit(ctx, limit, offset)
+}
+
+func (s *Service) issueTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	name string,
+	scopes []string,
+	expiresAt *time.Time,
+	rotatedFrom *int64,
+	now time.Time,
+) (*Issued, error) {
+
+	raw, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := s.repo.CreateTx(ctx, tx, name, raw[:displayPrefixLen], hashKey(raw), scopes, expiresAt, rotatedFrom, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Issued{Key: *k, Secret: raw}, nil
+}
+
+// normalizeScopes rejects unknown scopes and returns them sorted, once each
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidInput)
+	}
+	for _, sc := range scopes {
+		if !slices.Contains(Scopes, sc) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidInput, sc)
+		}
+	}
+
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+	return slices.Compact(scopes), nil
+}
+
+func newKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashKey — ключ случайный и длинный, соль и медленный хеш не нужны
+func hashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
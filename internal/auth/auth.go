@@ -0,0 +1,154 @@
+// Package auth verifies the bearer JWTs clients call the API with and
+// tells who the caller is.
+//
+// Two kinds of keys are accepted: a shared HS256 secret and RS256 public
+// keys from a local JWKS file, picked by the token's "kid" header. The
+// user is taken from the numeric "user_id" claim, or from "sub" when it
+// is absent.
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnauthenticated — токена нет или он не прошёл проверку
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+type Config struct {
+	// общий секрет HS256; пусто — HS256 не принимается
+	HS256Secret string
+	// путь к JWKS с публичными ключами RS256; пусто — RS256 не принимается
+	JWKSFile string
+	// проверяются, если заданы
+	Issuer   string
+	Audience string
+	// допуск расхождения часов для exp/nbf/iat
+	Leeway time.Duration
+}
+
+// Identity is the caller a token was issued to
+type Identity struct {
+	UserID  int64
+	Subject string
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+type Verifier struct {
+	secret []byte
+	keys   map[string]*rsa.PublicKey
+	parser *jwt.Parser
+}
+
+// NewVerifier loads the keys; at least one of HS256Secret and JWKSFile
+// must be set
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{}
+
+	if cfg.HS256Secret != "" {
+		v.secret = []byte(cfg.HS256Secret)
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+	}
+	if v.secret == nil && len(v.keys) == 0 {
+		return nil, errors.New("auth: no HS256 secret or RS256 keys configured")
+	}
+
+	var methods []string
+	if v.secret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if len(v.keys) > 0 {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	opts := []jwt.ParserOption{
+		// alg из заголовка ограничен настроенными ключами: HS256 с публичным ключом RSA как секретом не пройдёт
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// Verify checks the signature and registered claims of a compact JWT and
+// returns whom it identifies. All failures wrap ErrUnauthenticated.
+func (v *Verifier) Verify(raw string) (Identity, error) {
+	var c claims
+	if _, err := v.parser.ParseWithClaims(raw, &c, v.key); err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	id := Identity{UserID: c.UserID, Subject: c.Subject}
+	if id.UserID == 0 {
+		// sub — десятичный user_id
+		n, err := strconv.ParseInt(c.Subject, 10, 64)
+		if err != nil {
+			return Identity{}, fmt.Errorf("%w: token has no numeric user_id or sub", ErrUnauthenticated)
+		}
+		id.UserID = n
+	}
+	if id.UserID <= 0 {
+		return Identity{}, fmt.Errorf("%w: user id in token must be > 0", ErrUnauthenticated)
+	}
+
+	return id, nil
+}
+
+// key picks the verification key for the token's algorithm and kid
+func (v *Verifier) key(t *jwt.Token) (any, error) {
+	switch t.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.secret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" && len(v.keys) == 1 {
+			for _, k := range v.keys {
+				return k, nil
+			}
+		}
+		k, ok := v.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		return k, nil
+	}
+	return nil, fmt.Errorf("unexpected alg %q", t.Method.Alg())
+}
+
+type identityKey struct{}
+
+// WithIdentity returns ctx carrying the authenticated caller
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the caller put in ctx by WithIdentity
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
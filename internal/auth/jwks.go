@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// jwk is the subset of RFC 7517 fields needed for RSA signing keys
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS reads RSA public keys from a JWKS file, keyed by kid. Keys of
+// other types or meant for encryption are skipped.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: read JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("auth: parse JWKS %s: %w", path, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != "RS256") {
+			continue
+		}
+		if _, dup := keys[k.Kid]; dup {
+			return nil, fmt.Errorf("auth: JWKS %s: duplicate kid %q", path, k.Kid)
+		}
+
+		pub, err := k.rsaPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("auth: JWKS %s: key %d: %w", path, i, err)
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("auth: JWKS %s has no RS256 keys", path)
+	}
+
+	return keys, nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid n: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid e: %w", err)
+	}
+	if len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("invalid e")
+	}
+
+	pub := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+	if pub.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA key is shorter than 2048 bits")
+	}
+
+	return pub, nil
+}
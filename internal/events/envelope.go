@@ -0,0 +1,83 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	SpecVersion     = "1.0"
+	Source          = "/flash-sale-reservation"
+	DataContentType = "application/json"
+	// ContentType is the media type of a structured-mode CloudEvent
+	ContentType = "application/cloudevents+json"
+)
+
+// Envelope is a CloudEvents 1.0 event in structured JSON mode.
+// SchemaVersion is an extension attribute (extension names are lowercase
+// alphanumerics only, hence "schemaversion").
+type Envelope struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            time.Time       `json:"time"`
+	Subject         string          `json:"subject"`
+	DataSchema      string          `json:"dataschema"`
+	DataContentType string          `json:"datacontenttype"`
+	SchemaVersion   int             `json:"schemaversion"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// NewEnvelope validates payload against its JSON Schema and wraps it
+func NewEnvelope(payload Payload) (*Envelope, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	eventType := payload.EventType()
+	version := SchemaVersion(eventType)
+
+	if err := Validate(eventType, version, data); err != nil {
+		return nil, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Source:          Source,
+		Type:            eventType,
+		Time:            time.Now().UTC(),
+		Subject:         payload.Subject(),
+		DataSchema:      SchemaURI(eventType, version),
+		DataContentType: DataContentType,
+		SchemaVersion:   version,
+		Data:            data,
+	}, nil
+}
+
+// SchemaURI identifies the JSON Schema of an event type and version
+func SchemaURI(eventType string, version int) string {
+	return fmt.Sprintf("urn:flash-sale-reservation:schema:%s:v%d", eventType, version)
+}
+
+// newID returns a random UUIDv4
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,211 @@
+// Package events describes payloads written to outbox_events.
+//
+// Every payload is stored wrapped in a CloudEvents envelope (see
+// envelope.go) and must match its JSON Schema in schemas/. Payloads are a
+// public contract for downstream consumers and a released schema never
+// changes: any change to a payload, even a new optional field, gets a new
+// schema document and a bump in schemaVersions.
+package events
+
+import (
+	"fmt"
+	"time"
+)
+
+// schemaVersions is the schema version events of a type are written with;
+// types not listed are at version 1
+var schemaVersions = map[string]int{
+	// quantity, cart_id
+	TypeReservationCreated:   2,
+	TypeReservationConfirmed: 2,
+	TypeReservationExpired:   2,
+	// + reason, actor
+	TypeReservationCanceled: 3,
+	// reason sale_ended
+	TypeStockChanged: 2,
+}
+
+// SchemaVersion is the current schema version of eventType
+func SchemaVersion(eventType string) int {
+	if v, ok := schemaVersions[eventType]; ok {
+		return v
+	}
+	return 1
+}
+
+const (
+	TypeReservationCreated   = "ReservationCreated"
+	TypeReservationConfirmed = "ReservationConfirmed"
+	TypeReservationCanceled  = "ReservationCanceled"
+	TypeReservationExpired   = "ReservationExpired"
+	TypeReservationExtended  = "ReservationExtended"
+	TypeRaffleWon            = "RaffleWon"
+	TypeRaffleLost           = "RaffleLost"
+	TypeWaitlistPromoted     = "WaitlistPromoted"
+	TypeStockChanged         = "StockChanged"
+)
+
+// Причины изменения stock в StockChanged
+const (
+	StockReasonReserved  = "reserved"
+	StockReasonCanceled  = "canceled"
+	StockReasonExpired   = "expired"
+	StockReasonSaleEnded = "sale_ended"
+)
+
+// Причины RaffleLost
+const (
+	RaffleLostNotDrawn  = "not_drawn"
+	RaffleLostForfeited = "forfeited"
+)
+
+// Payload is the data part of an event
+type Payload interface {
+	EventType() string
+	// Subject is the CloudEvents subject, e.g. "reservations/42"
+	Subject() string
+}
+
+type ReservationCreated struct {
+	ReservationID int64     `json:"reservation_id"`
+	ProductID     int64     `json:"product_id"`
+	UserID        int64     `json:"user_id"`
+	Quantity      int       `json:"quantity"`
+	CartID        *int64    `json:"cart_id,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (ReservationCreated) EventType() string { return TypeReservationCreated }
+func (e ReservationCreated) Subject() string { return reservationSubject(e.ReservationID) }
+
+type ReservationConfirmed struct {
+	ReservationID int64     `json:"reservation_id"`
+	ProductID     int64     `json:"product_id"`
+	UserID        int64     `json:"user_id"`
+	Quantity      int       `json:"quantity"`
+	CartID        *int64    `json:"cart_id,omitempty"`
+	ConfirmedAt   time.Time `json:"confirmed_at"`
+}
+
+func (ReservationConfirmed) EventType() string { return TypeReservationConfirmed }
+func (e ReservationConfirmed) Subject() string { return reservationSubject(e.ReservationID) }
+
+// ReservationCanceled carries the cancel reason code and who canceled:
+// user, admin or system
+type ReservationCanceled struct {
+	ReservationID int64     `json:"reservation_id"`
+	ProductID     int64     `json:"product_id"`
+	UserID        int64     `json:"user_id"`
+	Quantity      int       `json:"quantity"`
+	CartID        *int64    `json:"cart_id,omitempty"`
+	Reason        string    `json:"reason"`
+	Actor         string    `json:"actor"`
+	CanceledAt    time.Time `json:"canceled_at"`
+}
+
+func (ReservationCanceled) EventType() string { return TypeReservationCanceled }
+func (e ReservationCanceled) Subject() string { return reservationSubject(e.ReservationID) }
+
+type ReservationExpired struct {
+	ReservationID int64     `json:"reservation_id"`
+	ProductID     int64     `json:"product_id"`
+	UserID        int64     `json:"user_id"`
+	Quantity      int       `json:"quantity"`
+	CartID        *int64    `json:"cart_id,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	ExpiredAt     time.Time `json:"expired_at"`
+}
+
+func (ReservationExpired) EventType() string { return TypeReservationExpired }
+func (e ReservationExpired) Subject() string { return reservationSubject(e.ReservationID) }
+
+// ReservationExtended is written each time a hold is prolonged;
+// Extensions is the count including this one.
+type ReservationExtended struct {
+	ReservationID     int64     `json:"reservation_id"`
+	ProductID         int64     `json:"product_id"`
+	UserID            int64     `json:"user_id"`
+	Quantity          int       `json:"quantity"`
+	PreviousExpiresAt time.Time `json:"previous_expires_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	Extensions        int       `json:"extensions"`
+	ExtendedAt        time.Time `json:"extended_at"`
+}
+
+func (ReservationExtended) EventType() string { return TypeReservationExtended }
+func (e ReservationExtended) Subject() string { return reservationSubject(e.ReservationID) }
+
+// RaffleWon is written for every winner of a draw, next to the
+// ReservationCreated of the reservation the winner got.
+type RaffleWon struct {
+	RaffleID      int64     `json:"raffle_id"`
+	ProductID     int64     `json:"product_id"`
+	UserID        int64     `json:"user_id"`
+	ReservationID int64     `json:"reservation_id"`
+	Quantity      int       `json:"quantity"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	DrawnAt       time.Time `json:"drawn_at"`
+}
+
+func (RaffleWon) EventType() string { return TypeRaffleWon }
+func (e RaffleWon) Subject() string { return raffleSubject(e.RaffleID) }
+
+// RaffleLost is written for every entrant who got no reservation.
+// Reason is forfeited when the user was drawn but already held the product.
+type RaffleLost struct {
+	RaffleID  int64     `json:"raffle_id"`
+	ProductID int64     `json:"product_id"`
+	UserID    int64     `json:"user_id"`
+	Reason    string    `json:"reason"`
+	DrawnAt   time.Time `json:"drawn_at"`
+}
+
+func (RaffleLost) EventType() string { return TypeRaffleLost }
+func (e RaffleLost) Subject() string { return raffleSubject(e.RaffleID) }
+
+// WaitlistPromoted is written when returned stock is offered to a waiting
+// user, next to the ReservationCreated of the reservation they got.
+type WaitlistPromoted struct {
+	WaitlistID    int64     `json:"waitlist_id"`
+	ProductID     int64     `json:"product_id"`
+	UserID        int64     `json:"user_id"`
+	ReservationID int64     `json:"reservation_id"`
+	Quantity      int       `json:"quantity"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	PromotedAt    time.Time `json:"promoted_at"`
+}
+
+func (WaitlistPromoted) EventType() string { return TypeWaitlistPromoted }
+func (e WaitlistPromoted) Subject() string { return waitlistSubject(e.WaitlistID) }
+
+// StockChanged carries the stock level after the change, so consumers can
+// rebuild inventory from the latest event without summing deltas.
+// ReservationID is empty when one event covers a whole expiry batch.
+type StockChanged struct {
+	ProductID     int64     `json:"product_id"`
+	Delta         int       `json:"delta"`
+	Stock         int       `json:"stock"`
+	Reason        string    `json:"reason"`
+	ReservationID *int64    `json:"reservation_id,omitempty"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
+
+func (StockChanged) EventType() string { return TypeStockChanged }
+func (e StockChanged) Subject() string { return productSubject(e.ProductID) }
+
+func reservationSubject(id int64) string {
+	return fmt.Sprintf("reservations/%d", id)
+}
+
+func raffleSubject(id int64) string {
+	return fmt.Sprintf("raffles/%d", id)
+}
+
+func waitlistSubject(id int64) string {
+	return fmt.Sprintf("waitlist/%d", id)
+}
+
+func productSubject(id int64) string {
+	return fmt.Sprintf("products/%d", id)
+}
@@ -0,0 +1,110 @@
+package events
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// samples has one payload per event type with every field set, optional
+// ones included. Schemas don't allow additional properties, so a field
+// added to a payload without a new schema version fails NewEnvelope here.
+func samples() []Payload {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cartID := int64(7)
+	reservationID := int64(42)
+
+	return []Payload{
+		ReservationCreated{ReservationID: 42, ProductID: 1, UserID: 5, Quantity: 2, CartID: &cartID, ExpiresAt: at, CreatedAt: at},
+		ReservationConfirmed{ReservationID: 42, ProductID: 1, UserID: 5, Quantity: 2, CartID: &cartID, ConfirmedAt: at},
+		ReservationCanceled{ReservationID: 42, ProductID: 1, UserID: 5, Quantity: 2, CartID: &cartID, Reason: "user_changed_mind", Actor: "user", CanceledAt: at},
+		ReservationExpired{ReservationID: 42, ProductID: 1, UserID: 5, Quantity: 2, CartID: &cartID, ExpiresAt: at, ExpiredAt: at},
+		ReservationExtended{ReservationID: 42, ProductID: 1, UserID: 5, Quantity: 2, PreviousExpiresAt: at, ExpiresAt: at.Add(time.Minute), Extensions: 1, ExtendedAt: at},
+		RaffleWon{RaffleID: 3, ProductID: 1, UserID: 5, ReservationID: 42, Quantity: 1, ExpiresAt: at, DrawnAt: at},
+		RaffleLost{RaffleID: 3, ProductID: 1, UserID: 6, Reason: RaffleLostForfeited, DrawnAt: at},
+		WaitlistPromoted{WaitlistID: 9, ProductID: 1, UserID: 5, ReservationID: 42, Quantity: 1, ExpiresAt: at, PromotedAt: at},
+		StockChanged{ProductID: 1, Delta: 2, Stock: 10, Reason: StockReasonSaleEnded, ReservationID: &reservationID, ChangedAt: at},
+	}
+}
+
+func TestNewEnvelope(t *testing.T) {
+	for _, payload := range samples() {
+		eventType := payload.EventType()
+		t.Run(eventType, func(t *testing.T) {
+			env, err := NewEnvelope(payload)
+			if err != nil {
+				t.Fatalf("NewEnvelope: %v", err)
+			}
+
+			version := SchemaVersion(eventType)
+			if env.Type != eventType || env.SchemaVersion != version {
+				t.Errorf("type %s v%d, want %s v%d", env.Type, env.SchemaVersion, eventType, version)
+			}
+			if want := SchemaURI(eventType, version); env.DataSchema != want {
+				t.Errorf("dataschema %s, want %s", env.DataSchema, want)
+			}
+			if env.Subject == "" || env.ID == "" {
+				t.Errorf("subject %q, id %q, want both set", env.Subject, env.ID)
+			}
+
+			// data — ровно сериализованный payload
+			want, _ := json.Marshal(payload)
+			if string(env.Data) != string(want) {
+				t.Errorf("data %s, want %s", env.Data, want)
+			}
+		})
+	}
+}
+
+// TestSchemas checks that every schema document compiles and that every
+// event type with a schema has a sample in samples.
+func TestSchemas(t *testing.T) {
+	var compiled map[string]*jsonschema.Schema
+	func() {
+		defer func() {
+			if err := recover(); err != nil {
+				t.Fatalf("schemas don't compile: %v", err)
+			}
+		}()
+		compiled = mustCompileSchemas()
+	}()
+
+	files, err := fs.Glob(schemaFS, "schemas/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compiled) != len(files) {
+		t.Errorf("compiled %d schemas, want %d", len(compiled), len(files))
+	}
+
+	sampled := make(map[string]bool)
+	for _, payload := range samples() {
+		sampled[payload.EventType()] = true
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".json")
+		eventType := name[:strings.LastIndex(name, ".v")]
+		if !sampled[eventType] {
+			t.Errorf("%s: no sample for %s", file, eventType)
+		}
+	}
+
+	for eventType, version := range schemaVersions {
+		if _, err := Schema(eventType, version); err != nil {
+			t.Errorf("%s v%d: %v", eventType, version, err)
+		}
+	}
+}
+
+// Поле, которого нет в схеме, не проходит валидацию
+func TestValidateRejectsUnknownField(t *testing.T) {
+	data := []byte(`{"product_id":1,"delta":2,"stock":10,"reason":"expired","changed_at":"2026-01-02T03:04:05Z","warehouse":"b"}`)
+	if err := Validate(TypeStockChanged, SchemaVersion(TypeStockChanged), data); err == nil {
+		t.Errorf("payload with an unknown field passed validation")
+	}
+}
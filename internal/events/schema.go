@@ -0,0 +1,91 @@
+package events
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Schemas are named "<EventType>.v<version>.json"
+//
+//go:embed schemas/*.json
+var schemaFS embed.FS
+
+var schemas = mustCompileSchemas()
+
+// Validate checks event data against the schema of eventType/version
+func Validate(eventType string, version int, data []byte) error {
+	schema, ok := schemas[SchemaURI(eventType, version)]
+	if !ok {
+		return fmt.Errorf("no schema for %s v%d", eventType, version)
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if err := schema.Validate(doc); err != nil {
+		return fmt.Errorf("%s v%d: %w", eventType, version, err)
+	}
+
+	return nil
+}
+
+// Schema returns the raw JSON Schema document, e.g. for publishing to consumers
+func Schema(eventType string, version int) ([]byte, error) {
+	return schemaFS.ReadFile(path.Join("schemas", fmt.Sprintf("%s.v%d.json", eventType, version)))
+}
+
+func mustCompileSchemas() map[string]*jsonschema.Schema {
+	files, err := fs.Glob(schemaFS, "schemas/*.json")
+	if err != nil {
+		panic(err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+
+	var uris []string
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".json")
+		dot := strings.LastIndex(name, ".v")
+		if dot < 0 {
+			panic("events: bad schema file name " + file)
+		}
+		eventType := name[:dot]
+		version, err := strconv.Atoi(name[dot+2:])
+		if err != nil {
+			panic("events: bad schema file name " + file)
+		}
+
+		raw, err := schemaFS.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+		if err != nil {
+			panic(fmt.Sprintf("events: %s: %v", file, err))
+		}
+
+		uri := SchemaURI(eventType, version)
+		if err := compiler.AddResource(uri, doc); err != nil {
+			panic(fmt.Sprintf("events: %s: %v", file, err))
+		}
+		uris = append(uris, uri)
+	}
+
+	compiled := make(map[string]*jsonschema.Schema, len(uris))
+	for _, uri := range uris {
+		compiled[uri] = compiler.MustCompile(uri)
+	}
+
+	return compiled
+}
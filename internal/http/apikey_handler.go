@@ -0,0 +1,118 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"flash-sale-reservation/internal/apikey"
+)
+
+type APIKeyHandler struct {
+	service *apikey.Service
+}
+
+func NewAPIKeyHandler(service *apikey.Service) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// POST /admin/api-keys — ключ в ответе показывается один раз
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	issued, err := h.service.Create(r.Context(), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(issued)
+}
+
+// GET /admin/api-keys
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.List(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// POST /admin/api-keys/{id}/rotate — {"grace_seconds": 3600}, тело необязательно
+func (h *APIKeyHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	var req struct {
+		GraceSeconds int `json:"grace_seconds"`
+	}
+	if err := decodeOptional(r, &req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	issued, err := h.service.Rotate(r.Context(), id, time.Duration(req.GraceSeconds)*time.Second)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(issued)
+}
+
+// POST /admin/api-keys/{id}/revoke
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	key, err := h.service.Revoke(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// GET /admin/audit-log?limit=&offset=
+func (h *APIKeyHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	var (
+		limit  = 50
+		offset = 0
+	)
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, _ = strconv.Atoi(v)
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, _ = strconv.Atoi(v)
+	}
+
+	entries, err := h.service.ListAudit(r.Context(), limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
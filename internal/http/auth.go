@@ -0,0 +1,66 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"flash-sale-reservation/internal/auth"
+)
+
+// Authenticator requires a valid "Authorization: Bearer <JWT>" and puts
+// the caller into the request context. Handlers take the user from there
+// (see tokenUserID), not from the request body.
+type Authenticator struct {
+	verifier *auth.Verifier
+}
+
+func NewAuthenticator(verifier *auth.Verifier) *Authenticator {
+	return &Authenticator{verifier: verifier}
+}
+
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, "bearer token is required")
+			return
+		}
+
+		id, err := a.verifier.Verify(raw)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+var errUserMismatch = errors.New("user_id does not match the token")
+
+// tokenUserID returns the authenticated user. A user_id the client also
+// sent in the body or query must be the same user; 0 means not sent.
+func tokenUserID(r *http.Request, claimed int64) (int64, error) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		// маршрут без Authenticator: отвечаем 401, а не пускаем анонимно
+		return 0, fmt.Errorf("%w: bearer token is required", auth.ErrUnauthenticated)
+	}
+	if claimed != 0 && claimed != id.UserID {
+		return 0, errUserMismatch
+	}
+	return id.UserID, nil
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"flash-sale-reservation/internal/product"
+)
+
+type CampaignHandler struct {
+	service *product.Service
+}
+
+func NewCampaignHandler(service *product.Service) *CampaignHandler {
+	return &CampaignHandler{service: service}
+}
+
+// POST /campaigns
+func (h *CampaignHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name       string `json:"name"`
+		MaxPerUser int    `json:"max_per_user"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	c, err := h.service.CreateCampaign(r.Context(), req.Name, req.MaxPerUser)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(c)
+}
+
+// GET /campaigns
+func (h *CampaignHandler) List(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := h.service.ListCampaigns(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaigns)
+}
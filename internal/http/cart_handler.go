@@ -0,0 +1,129 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"flash-sale-reservation/internal/reservation"
+)
+
+type CartHandler struct {
+	service *reservation.Service
+}
+
+func NewCartHandler(service *reservation.Service) *CartHandler {
+	return &CartHandler{service: service}
+}
+
+// POST /carts
+func (h *CartHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID int64                  `json:"user_id"`
+		Items  []reservation.CartItem `json:"items"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	userID, err := tokenUserID(r, req.UserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// без quantity — одна единица, как в POST /reservations
+	for i := range req.Items {
+		if req.Items[i].Quantity == 0 {
+			req.Items[i].Quantity = 1
+		}
+	}
+
+	cart, err := h.service.CreateCart(r.Context(), userID, req.Items)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cart)
+}
+
+// GET /carts/{id}
+func (h *CartHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	userID, err := tokenUserID(r, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	cart, err := h.service.GetCart(r.Context(), id, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cart)
+}
+
+// POST /carts/{id}/confirm
+func (h *CartHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	userID, err := tokenUserID(r, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.service.ConfirmCart(r.Context(), id, userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// POST /carts/{id}/cancel — отмена своим пользователем
+func (h *CartHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	h.cancel(w, r, reservation.ActorUser)
+}
+
+// POST /admin/carts/{id}/cancel
+func (h *CartHandler) AdminCancel(w http.ResponseWriter, r *http.Request) {
+	h.cancel(w, r, reservation.ActorAdmin)
+}
+
+func (h *CartHandler) cancel(w http.ResponseWriter, r *http.Request, actor string) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	var req cancelRequest
+	err := decodeOptional(r, &req)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	c := reservation.Cancellation{Actor: actor, Reason: req.Reason}
+	if actor == reservation.ActorUser {
+		if c.UserID, err = tokenUserID(r, req.UserID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.service.CancelCart(r.Context(), id, c); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
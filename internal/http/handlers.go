@@ -15,23 +15,16 @@ func NewProductHandler(service *product.Service) *ProductHandler {
 }
 
 func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Name  string `json:"name"`
-		Stock int    `json:"stock"`
-	}
+	var req product.CreateInput
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
 		return
 	}
 
-	p, err := h.service.Create(
-		r.Context(),
-		req.Name,
-		req.Stock,
-	)
+	p, err := h.service.Create(r.Context(), req)
 	if err != nil {
-		http.Error(w, "failed to create product", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -40,10 +33,11 @@ func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(p)
 }
 
+// GET /products?sale=upcoming|live|ended
 func (h *ProductHandler) List(w http.ResponseWriter, r *http.Request) {
-	products, err := h.service.List(r.Context())
+	products, err := h.service.List(r.Context(), r.URL.Query().Get("sale"))
 	if err != nil {
-		http.Error(w, "failed to get products", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,162 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash-sale-reservation/internal/auth"
+	"flash-sale-reservation/internal/idempotency"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotentReplayHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodySize   = 1 << 20
+	// после этого IN_PROGRESS-запись считается брошенной (процесс упал)
+	idempotencyLockTimeout = 30 * time.Second
+)
+
+// Idempotency makes POST handlers safe to retry. A request with an
+// Idempotency-Key header is executed once per (user, method + path, key);
+// a duplicate gets the stored response replayed, a duplicate that is still
+// running gets 409, and the same key with a different body gets 422.
+// 5xx responses are not stored, so the client may retry them.
+//
+// The user comes from Authenticator, which must run first: without an
+// owner one client could replay another's response by guessing its key,
+// so a keyed request without identity is rejected with 401.
+type Idempotency struct {
+	repo *idempotency.Repository
+}
+
+func NewIdempotency(repo *idempotency.Repository) *Idempotency {
+	return &Idempotency{repo: repo}
+}
+
+func (m *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidInput, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+		if err != nil || len(body) > maxIdempotentBodySize {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		id, ok := auth.FromContext(r.Context())
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			writeProblem(w, r, http.StatusUnauthorized, codeUnauthorized, "bearer token is required with Idempotency-Key")
+			return
+		}
+		// ключи разных пользователей не пересекаются
+		scope := "user:" + strconv.FormatInt(id.UserID, 10) + " " + r.Method + " " + r.URL.Path
+		fingerprint := requestFingerprint(r.Method, r.URL.Path, body)
+
+		owned, existing, err := m.repo.Acquire(r.Context(), scope, key, fingerprint, idempotencyLockTimeout)
+		if err != nil {
+			log.Printf("idempotency: acquire %q: %v", key, err)
+			writeProblem(w, r, http.StatusServiceUnavailable, codeUnavailable, "idempotency store unavailable")
+			return
+		}
+
+		if !owned {
+			replay(w, r, existing, fingerprint)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		// клиент мог уже отключиться — сохраняем ответ всё равно
+		ctx := context.WithoutCancel(r.Context())
+
+		status := rec.statusCode()
+		if status >= http.StatusInternalServerError {
+			if err := m.repo.Release(ctx, scope, key); err != nil {
+				log.Printf("idempotency: release %q: %v", key, err)
+			}
+			return
+		}
+
+		if err := m.repo.Complete(ctx, scope, key, status, w.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+			log.Printf("idempotency: complete %q: %v", key, err)
+		}
+	})
+}
+
+func replay(w http.ResponseWriter, r *http.Request, existing *idempotency.Record, fingerprint string) {
+	switch {
+	case existing == nil || (existing.Fingerprint == fingerprint && existing.Status != idempotency.StatusCompleted):
+		w.Header().Set("Retry-After", "1")
+		writeProblem(w, r, http.StatusConflict, codeIdempotencyConflict, "request with this Idempotency-Key is being processed")
+
+	case existing.Fingerprint != fingerprint:
+		writeProblem(w, r, http.StatusUnprocessableEntity, codeIdempotencyMismatch, "Idempotency-Key was already used with a different request")
+
+	default:
+		if existing.ContentType != "" {
+			w.Header().Set("Content-Type", existing.ContentType)
+		}
+		w.Header().Set(idempotentReplayHeader, "true")
+		w.WriteHeader(existing.ResponseStatus)
+		_, _ = w.Write(existing.ResponseBody)
+	}
+}
+
+func requestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes the response through and keeps a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
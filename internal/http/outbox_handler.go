@@ -0,0 +1,56 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"flash-sale-reservation/internal/outbox"
+)
+
+type OutboxHandler struct {
+	service *outbox.Service
+}
+
+func NewOutboxHandler(service *outbox.Service) *OutboxHandler {
+	return &OutboxHandler{service: service}
+}
+
+// GET /admin/outbox/dead?limit=&offset=
+func (h *OutboxHandler) ListDead(w http.ResponseWriter, r *http.Request) {
+	var (
+		limit  = 20
+		offset = 0
+	)
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, _ = strconv.Atoi(v)
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, _ = strconv.Atoi(v)
+	}
+
+	events, err := h.service.ListDead(r.Context(), limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// POST /admin/outbox/{id}/replay
+func (h *OutboxHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	if err := h.service.Replay(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,174 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"flash-sale-reservation/internal/apikey"
+	"flash-sale-reservation/internal/auth"
+	"flash-sale-reservation/internal/outbox"
+	"flash-sale-reservation/internal/product"
+	"flash-sale-reservation/internal/queue"
+	"flash-sale-reservation/internal/reservation"
+)
+
+// problemTypePrefix + code is the RFC 7807 "type" of every error response
+const problemTypePrefix = "urn:flash-sale-reservation:problem:"
+
+// Problem is an RFC 7807 problem details body. Code is stable and meant
+// for clients to branch on; Detail is for humans and may change.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+// Коды ошибок API
+const (
+	codeInvalidBody         = "invalid_body"
+	codeInvalidInput        = "invalid_input"
+	codeNotFound            = "not_found"
+	codeUnauthorized        = "unauthorized"
+	codeForbidden           = "forbidden"
+	codeOutOfStock          = "out_of_stock"
+	codeAlreadyReserved     = "already_reserved"
+	codeInvalidTransition   = "invalid_transition"
+	codeAlreadyRotated      = "already_rotated"
+	codeExpired             = "expired"
+	codeSaleNotStarted      = "sale_not_started"
+	codeSaleEnded           = "sale_ended"
+	codeLimitExceeded       = "limit_exceeded"
+	codeRaffleOnly          = "raffle_only"
+	codeQueueTokenRequired  = "queue_token_required"
+	codeQueueTokenInvalid   = "queue_token_invalid"
+	codeQueueNotAdmitted    = "queue_not_admitted"
+	codeQueueTokenExpired   = "queue_token_expired"
+	codeQueueTokenUsed      = "queue_token_used"
+	codeRateLimited         = "rate_limited"
+	codeIdempotencyConflict = "idempotency_conflict"
+	codeIdempotencyMismatch = "idempotency_key_reused"
+	codeUnavailable         = "unavailable"
+	codeInternal            = "internal"
+)
+
+type problemKind struct {
+	err    error
+	status int
+	code   string
+}
+
+// problemKinds maps domain errors to responses; the first match wins
+var problemKinds = []problemKind{
+	{reservation.ErrNotFound, http.StatusNotFound, codeNotFound},
+	{product.ErrNotFound, http.StatusNotFound, codeNotFound},
+	{outbox.ErrNotFound, http.StatusNotFound, codeNotFound},
+	{apikey.ErrNotFound, http.StatusNotFound, codeNotFound},
+	{reservation.ErrOutOfStock, http.StatusConflict, codeOutOfStock},
+	{reservation.ErrAlreadyReserved, http.StatusConflict, codeAlreadyReserved},
+	{reservation.ErrInvalidTransition, http.StatusConflict, codeInvalidTransition},
+	{apikey.ErrAlreadyRotated, http.StatusConflict, codeAlreadyRotated},
+	{reservation.ErrExpired, http.StatusGone, codeExpired},
+	{auth.ErrUnauthenticated, http.StatusUnauthorized, codeUnauthorized},
+	{apikey.ErrUnauthenticated, http.StatusUnauthorized, codeUnauthorized},
+	{reservation.ErrForbidden, http.StatusForbidden, codeForbidden},
+	{errUserMismatch, http.StatusForbidden, codeForbidden},
+	{product.ErrSaleNotStarted, http.StatusForbidden, codeSaleNotStarted},
+	{product.ErrSaleEnded, http.StatusForbidden, codeSaleEnded},
+	{reservation.ErrLimitExceeded, http.StatusForbidden, codeLimitExceeded},
+	{reservation.ErrRaffleOnly, http.StatusForbidden, codeRaffleOnly},
+	{queue.ErrTokenRequired, http.StatusForbidden, codeQueueTokenRequired},
+	{queue.ErrTokenInvalid, http.StatusForbidden, codeQueueTokenInvalid},
+	{queue.ErrNotAdmitted, http.StatusForbidden, codeQueueNotAdmitted},
+	{queue.ErrTokenExpired, http.StatusForbidden, codeQueueTokenExpired},
+	{queue.ErrTokenUsed, http.StatusForbidden, codeQueueTokenUsed},
+	{reservation.ErrUnavailable, http.StatusServiceUnavailable, codeUnavailable},
+	{reservation.ErrInvalidInput, http.StatusBadRequest, codeInvalidInput},
+	{product.ErrInvalidInput, http.StatusBadRequest, codeInvalidInput},
+	{outbox.ErrInvalidInput, http.StatusBadRequest, codeInvalidInput},
+	{apikey.ErrInvalidInput, http.StatusBadRequest, codeInvalidInput},
+}
+
+// writeError answers with the problem for a service error. Unknown errors
+// are logged and answered without their text: 503 when the database is
+// unreachable, 500 otherwise.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	for _, k := range problemKinds {
+		if errors.Is(err, k.err) {
+			writeProblem(w, r, k.status, k.code, err.Error())
+			return
+		}
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeProblem(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+	case isUnavailable(err):
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		writeProblem(w, r, http.StatusServiceUnavailable, codeUnavailable, "service is temporarily unavailable, retry later")
+	default:
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		writeProblem(w, r, http.StatusInternalServerError, codeInternal, "internal error")
+	}
+}
+
+// writeProblem writes an application/problem+json response
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(Problem{
+		Type:     problemTypePrefix + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	})
+}
+
+// isUnavailable tells outages and transient failures worth retrying —
+// lost connections, timeouts, PostgreSQL shutting down or out of
+// resources, serialization failures and deadlocks — from bugs
+func isUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "08"), // connection exception
+			strings.HasPrefix(pgErr.Code, "53"), // insufficient resources
+			strings.HasPrefix(pgErr.Code, "57"), // operator intervention
+			pgErr.Code == "40001",               // serialization_failure
+			pgErr.Code == "40P01":               // deadlock_detected
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,91 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"flash-sale-reservation/internal/product"
+	"flash-sale-reservation/internal/queue"
+)
+
+// queueTokenHeader carries the waiting room token on POST /reservations
+const queueTokenHeader = "X-Queue-Token"
+
+type QueueHandler struct {
+	room     *queue.Room
+	products *product.Service
+}
+
+func NewQueueHandler(room *queue.Room, products *product.Service) *QueueHandler {
+	return &QueueHandler{
+		room:     room,
+		products: products,
+	}
+}
+
+// POST /products/{id}/queue
+func (h *QueueHandler) Join(w http.ResponseWriter, r *http.Request) {
+	productID, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	// тело необязательно: пользователь — из токена
+	var req struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	if err := decodeOptional(r, &req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	userID, err := tokenUserID(r, req.UserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	p, err := h.products.GetByID(r.Context(), productID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !p.Queued {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidInput, "product is not queued, reserve it directly")
+		return
+	}
+
+	t, err := h.room.Join(r.Context(), productID, userID)
+	if err != nil {
+		writeRoomUnavailable(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// GET /queue/{token}
+func (h *QueueHandler) Status(w http.ResponseWriter, r *http.Request) {
+	t, err := h.room.Status(r.Context(), chi.URLParam(r, "token"))
+	if errors.Is(err, queue.ErrTokenInvalid) {
+		writeProblem(w, r, http.StatusNotFound, codeNotFound, "queue token not found")
+		return
+	}
+	if err != nil {
+		writeRoomUnavailable(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+func writeRoomUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("waiting room: %v", err)
+	writeProblem(w, r, http.StatusServiceUnavailable, codeUnavailable, "waiting room unavailable")
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"flash-sale-reservation/internal/reservation"
+)
+
+type RaffleHandler struct {
+	service *reservation.Service
+}
+
+func NewRaffleHandler(service *reservation.Service) *RaffleHandler {
+	return &RaffleHandler{service: service}
+}
+
+// POST /raffles
+func (h *RaffleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ProductID          int64     `json:"product_id"`
+		Quantity           int       `json:"quantity"`
+		RegistrationEndsAt time.Time `json:"registration_ends_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	// без quantity — одна единица победителю
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	raffle, err := h.service.CreateRaffle(r.Context(), req.ProductID, req.Quantity, req.RegistrationEndsAt)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(raffle)
+}
+
+// GET /raffles/{id}
+func (h *RaffleHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	raffle, err := h.service.GetRaffle(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(raffle)
+}
+
+// POST /raffles/{id}/entries
+func (h *RaffleHandler) Enter(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	// тело необязательно: пользователь — из токена
+	var req struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	if err := decodeOptional(r, &req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	userID, err := tokenUserID(r, req.UserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	entry, err := h.service.EnterRaffle(r.Context(), id, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// GET /raffles/{id}/verify
+func (h *RaffleHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	v, err := h.service.VerifyRaffle(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// POST /admin/raffles/{id}/close
+func (h *RaffleHandler) Close(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	raffle, err := h.service.CloseRaffle(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(raffle)
+}
+
+// POST /admin/raffles/{id}/draw
+func (h *RaffleHandler) Draw(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	raffle, err := h.service.DrawRaffle(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(raffle)
+}
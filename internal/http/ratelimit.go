@@ -0,0 +1,168 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash-sale-reservation/internal/auth"
+	"flash-sale-reservation/internal/ratelimit"
+)
+
+// RouteLimit is the budget of one route per user (from the token) and
+// per client IP; a zero Limit turns that check off
+type RouteLimit struct {
+	User ratelimit.Limit
+	IP   ratelimit.Limit
+}
+
+// RateLimits are the limits of the routes. Every route counts in its own
+// budget: spending the reservation limit doesn't block the waitlist.
+type RateLimits struct {
+	Reserve        RouteLimit // POST /reservations
+	Cart           RouteLimit // POST /carts
+	QueueJoin      RouteLimit // POST /products/{id}/queue
+	WaitlistJoin   RouteLimit // POST /products/{id}/waitlist
+	WaitlistCancel RouteLimit // POST /waitlist/{id}/cancel
+	RaffleEntry    RouteLimit // POST /raffles/{id}/entries
+	// confirm / cancel / extend резервов и корзин: размер общий,
+	// бюджет у каждого маршрута свой
+	UserWrite RouteLimit
+	// маршруты под X-API-Key, на ключ и на IP
+	APIKey ratelimit.Limit
+}
+
+// rateSubject names who a request is counted against; ok = false when the
+// request has no such subject (e.g. no token)
+type rateSubject func(r *http.Request) (key string, ok bool)
+
+// rateRule is a budget of one subject on a route
+type rateRule struct {
+	limit   ratelimit.Limit
+	subject rateSubject
+}
+
+func perUser(l ratelimit.Limit) rateRule   { return rateRule{l, byUser} }
+func perIP(l ratelimit.Limit) rateRule     { return rateRule{l, byIP} }
+func perAPIKey(l ratelimit.Limit) rateRule { return rateRule{l, byAPIKey} }
+
+func byUser(r *http.Request) (string, bool) {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		return "", false
+	}
+	return "user:" + strconv.FormatInt(id.UserID, 10), true
+}
+
+func byIP(r *http.Request) (string, bool) {
+	return "ip:" + clientIP(r), true
+}
+
+// byAPIKey counts the key as sent, before it is checked: unknown keys
+// still cost a lookup, so they are limited too. The key is hashed so it
+// doesn't end up in Redis.
+func byAPIKey(r *http.Request) (string, bool) {
+	raw := r.Header.Get(apiKeyHeader)
+	if raw == "" {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(raw))
+	return "key:" + hex.EncodeToString(sum[:8]), true
+}
+
+// RateLimiter answers 429 once a subject of the request runs out of its
+// budget for the route and sets RateLimit-* headers on every response
+type RateLimiter struct {
+	limiter ratelimit.Limiter
+}
+
+func NewRateLimiter(limiter ratelimit.Limiter) *RateLimiter {
+	return &RateLimiter{limiter: limiter}
+}
+
+// Limit counts each request against every rule whose subject it has, in
+// that subject's budget for route; all of them must allow it. The headers
+// describe the tightest budget.
+func (m *RateLimiter) Limit(route string, rules ...rateRule) func(http.Handler) http.Handler {
+	var enabled []rateRule
+	for _, rule := range rules {
+		if rule.limit.Enabled() {
+			enabled = append(enabled, rule)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(enabled) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				tightest ratelimit.Result
+				limit    ratelimit.Limit
+				checked  bool
+			)
+
+			for _, rule := range enabled {
+				key, ok := rule.subject(r)
+				if !ok {
+					continue
+				}
+
+				res, err := m.limiter.Allow(r.Context(), route+":"+key, rule.limit)
+				if err != nil {
+					// лимитер недоступен совсем — запрос не блокируем
+					log.Printf("ratelimit: %s %s: %v", r.Method, r.URL.Path, err)
+					continue
+				}
+
+				if !checked || tighter(res, tightest) {
+					tightest, limit = res, rule.limit
+				}
+				checked = true
+			}
+
+			if !checked {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Capacity(), ceilSeconds(limit.Period)))
+			h.Set("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(tightest.ResetAfter)))
+
+			if !tightest.Allowed {
+				retry := ceilSeconds(tightest.RetryAfter)
+				h.Set("Retry-After", strconv.Itoa(retry))
+				writeProblem(w, r, http.StatusTooManyRequests, codeRateLimited,
+					fmt.Sprintf("rate limit %s exceeded, retry in %ds", limit, retry))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tighter: a denial over an allowance, then the longer wait or the
+// smaller remainder
+func tighter(a, b ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
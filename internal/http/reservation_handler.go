@@ -2,7 +2,9 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi/v5"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -22,16 +24,41 @@ func (h *ReservationHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		ProductID int64 `json:"product_id"`
 		UserID    int64 `json:"user_id"`
+		Quantity  int   `json:"quantity"`
+		// Waitlist — если товара нет, встать в очередь ожидания (202)
+		Waitlist bool `json:"waitlist"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
 		return
 	}
 
-	res, err := h.service.Create(r.Context(), req.ProductID, req.UserID)
+	userID, err := tokenUserID(r, req.UserID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+
+	// без quantity — одна единица, как раньше
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	token := r.Header.Get(queueTokenHeader)
+
+	res, err := h.service.Create(r.Context(), req.ProductID, userID, req.Quantity, token)
+	if errors.Is(err, reservation.ErrOutOfStock) && req.Waitlist {
+		entry, err := h.service.JoinWaitlist(r.Context(), req.ProductID, userID, req.Quantity)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeWaitlistEntry(w, http.StatusAccepted, entry)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -44,51 +71,149 @@ func (h *ReservationHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, _ := strconv.ParseInt(idStr, 10, 64)
 
-	res, err := h.service.GetByID(r.Context(), id)
+	userID, err := tokenUserID(r, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res, err := h.service.GetByID(r.Context(), id, userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(res)
 }
 
+// GET /reservations/{id}/history
+func (h *ReservationHandler) History(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	userID, err := tokenUserID(r, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	history, err := h.service.History(r.Context(), id, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
 // POST /reservations/{id}/confirm
 func (h *ReservationHandler) Confirm(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 
-	if err := h.service.Confirm(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	userID, err := tokenUserID(r, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.service.Confirm(r.Context(), id, userID); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-// POST /reservations/{id}/cancel
+// POST /reservations/{id}/extend
+func (h *ReservationHandler) Extend(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	userID, err := tokenUserID(r, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res, err := h.service.Extend(r.Context(), id, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// POST /reservations/{id}/cancel — отмена своим пользователем
 func (h *ReservationHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	h.cancel(w, r, reservation.ActorUser)
+}
+
+// POST /admin/reservations/{id}/cancel — отмена любого резерва
+func (h *ReservationHandler) AdminCancel(w http.ResponseWriter, r *http.Request) {
+	h.cancel(w, r, reservation.ActorAdmin)
+}
+
+func (h *ReservationHandler) cancel(w http.ResponseWriter, r *http.Request, actor string) {
 	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 
-	if err := h.service.Cancel(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req cancelRequest
+	err := decodeOptional(r, &req)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	c := reservation.Cancellation{Actor: actor, Reason: req.Reason}
+	if actor == reservation.ActorUser {
+		if c.UserID, err = tokenUserID(r, req.UserID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.service.Cancel(r.Context(), id, c); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-// GET /reservations?user_id=&status=&limit=&offset=
+// cancelRequest is the body of cancel endpoints. user_id is optional and,
+// if sent, must match the token; admins send only the reason. The whole
+// body may be omitted to cancel with the default reason.
+type cancelRequest struct {
+	UserID int64  `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// decodeOptional decodes a JSON body into v; an empty body leaves v as is
+func decodeOptional(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// GET /reservations?status=&limit=&offset= — резервы пользователя из токена
 func (h *ReservationHandler) List(w http.ResponseWriter, r *http.Request) {
 	var (
-		userID *int64
-		status *string
-		limit  = 20
-		offset = 0
+		claimed int64
+		status  *string
+		limit   = 20
+		offset  = 0
 	)
 
+	// user_id в query оставлен для совместимости, но должен совпадать с токеном
 	if v := r.URL.Query().Get("user_id"); v != "" {
-		id, _ := strconv.ParseInt(v, 10, 64)
-		userID = &id
+		claimed, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	userID, err := tokenUserID(r, claimed)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
 	if v := r.URL.Query().Get("status"); v != "" {
@@ -103,9 +228,9 @@ func (h *ReservationHandler) List(w http.ResponseWriter, r *http.Request) {
 		offset, _ = strconv.Atoi(v)
 	}
 
-	res, err := h.service.List(r.Context(), userID, status, limit, offset)
+	res, err := h.service.List(r.Context(), &userID, status, limit, offset)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -117,7 +242,7 @@ func (h *ReservationHandler) SyncExpired(w http.ResponseWriter, r *http.Request)
 
 	count, err := h.service.ExpireReservations(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
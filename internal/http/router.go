@@ -2,9 +2,17 @@ package http
 
 import (
 	"net/http"
+	"net/netip"
 
+	"flash-sale-reservation/internal/apikey"
+	"flash-sale-reservation/internal/auth"
+	"flash-sale-reservation/internal/idempotency"
+	"flash-sale-reservation/internal/outbox"
 	"flash-sale-reservation/internal/product"
+	"flash-sale-reservation/internal/queue"
+	"flash-sale-reservation/internal/ratelimit"
 	"flash-sale-reservation/internal/reservation"
+	"flash-sale-reservation/internal/stock"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -12,9 +20,37 @@ import (
 func NewRouter(
 	productService *product.Service,
 	reservationService *reservation.Service,
+	outboxService *outbox.Service,
+	stockFeed *stock.Feed,
+	idempotencyRepo *idempotency.Repository,
+	room *queue.Room,
+	verifier *auth.Verifier,
+	apiKeyService *apikey.Service,
+	limiter ratelimit.Limiter,
+	limits RateLimits,
+	trustedProxies []netip.Prefix,
 ) http.Handler {
 
 	r := chi.NewRouter()
+	// адрес клиента — для лимитов по IP и журнала аудита
+	r.Use(NewClientIP(trustedProxies).Middleware)
+	idem := NewIdempotency(idempotencyRepo).Middleware
+	// authn идёт до idem: ключи идемпотентности разделены по пользователям
+	authn := NewAuthenticator(verifier).Middleware
+
+	// лимиты идут до idem и проверки API-ключа — 429 не доходит до БД
+	rl := NewRateLimiter(limiter)
+	route := func(name string, l RouteLimit) func(http.Handler) http.Handler {
+		return rl.Limit(name, perUser(l.User), perIP(l.IP))
+	}
+	adminLimit := rl.Limit("admin", perAPIKey(limits.APIKey), perIP(limits.APIKey))
+
+	// API-ключ с нужным scope; вызовы пишутся в admin_audit_log
+	keys := NewAPIKeyAuth(apiKeyService)
+	scope := func(s string) func(http.Handler) http.Handler {
+		require := keys.Require(s)
+		return func(next http.Handler) http.Handler { return adminLimit(require(next)) }
+	}
 
 	// ---------- Health ----------
 	r.Get("/health", func(w http.ResponseWriter, _ *http.Request) {
@@ -24,26 +60,107 @@ func NewRouter(
 
 	// ---------- Products ----------
 	productHandler := NewProductHandler(productService)
+	stockHandler := NewStockStreamHandler(stockFeed)
+	queueHandler := NewQueueHandler(room, productService)
+	waitlistHandler := NewWaitlistHandler(reservationService)
 	r.Route("/products", func(r chi.Router) {
-		r.Post("/", productHandler.Create)
+		r.With(scope(apikey.ScopeProductsWrite)).Post("/", productHandler.Create)
 		r.Get("/", productHandler.List)
+		r.Get("/stream", stockHandler.StreamMany)     // SSE, ?ids=1,2,3
+		r.Get("/{id}/stream", stockHandler.StreamOne) // SSE
+		// встать в очередь
+		r.With(authn, route("queue-join", limits.QueueJoin)).Post("/{id}/queue", queueHandler.Join)
+		r.With(authn, route("waitlist-join", limits.WaitlistJoin), idem).Post("/{id}/waitlist", waitlistHandler.Join)
+	})
+
+	// ---------- Waiting room ----------
+	r.Get("/queue/{token}", queueHandler.Status) // позиция и ETA
+
+	// ---------- Waitlist ----------
+	r.Route("/waitlist", func(r chi.Router) {
+		r.Use(authn)
+		r.Get("/{id}", waitlistHandler.GetByID) // статус и позиция
+		r.With(route("waitlist-cancel", limits.WaitlistCancel), idem).Post("/{id}/cancel", waitlistHandler.Cancel)
+	})
+
+	// ---------- Campaigns ----------
+	campaignHandler := NewCampaignHandler(productService)
+	r.Route("/campaigns", func(r chi.Router) {
+		r.With(scope(apikey.ScopeProductsWrite)).Post("/", campaignHandler.Create)
+		r.Get("/", campaignHandler.List)
 	})
 
 	// ---------- Reservations ----------
 	reservationHandler := NewReservationHandler(reservationService)
 	r.Route("/reservations", func(r chi.Router) {
-		r.Post("/", reservationHandler.Create)     // создать резерв
-		r.Get("/{id}", reservationHandler.GetByID) // получить по id
-		r.Post("/{id}/confirm", reservationHandler.Confirm)
-		r.Post("/{id}/cancel", reservationHandler.Cancel)
-		r.Get("/", reservationHandler.List) // фильтры + пагинация
+		// пользователь — из JWT
+		r.Group(func(r chi.Router) {
+			r.Use(authn)
+			r.Get("/{id}", reservationHandler.GetByID) // только свой
+			r.Get("/{id}/history", reservationHandler.History)
+			// создать резерв
+			r.With(route("reserve", limits.Reserve), idem).Post("/", reservationHandler.Create)
+			r.With(route("reservation-confirm", limits.UserWrite), idem).Post("/{id}/confirm", reservationHandler.Confirm)
+			r.With(route("reservation-cancel", limits.UserWrite), idem).Post("/{id}/cancel", reservationHandler.Cancel)
+			r.With(route("reservation-extend", limits.UserWrite), idem).Post("/{id}/extend", reservationHandler.Extend)
+			r.Get("/", reservationHandler.List) // свои резервы + пагинация
+		})
+	})
+
+	// ---------- Carts ----------
+	cartHandler := NewCartHandler(reservationService)
+	r.Route("/carts", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(authn)
+			r.Get("/{id}", cartHandler.GetByID)
+			// все строки или ничего
+			r.With(route("cart", limits.Cart), idem).Post("/", cartHandler.Create)
+			r.With(route("cart-confirm", limits.UserWrite), idem).Post("/{id}/confirm", cartHandler.Confirm)
+			r.With(route("cart-cancel", limits.UserWrite), idem).Post("/{id}/cancel", cartHandler.Cancel)
+		})
+	})
+
+	// ---------- Raffles ----------
+	raffleHandler := NewRaffleHandler(reservationService)
+	r.Route("/raffles", func(r chi.Router) {
+		r.With(scope(apikey.ScopeProductsWrite)).Post("/", raffleHandler.Create)
+		r.Get("/{id}", raffleHandler.GetByID)
+		// регистрация
+		r.With(authn, route("raffle-entry", limits.RaffleEntry), idem).Post("/{id}/entries", raffleHandler.Enter)
+		r.Get("/{id}/verify", raffleHandler.Verify) // перепроверка по seed
 	})
 
 	// ---------- Admin ----------
+	outboxHandler := NewOutboxHandler(outboxService)
+	apiKeyHandler := NewAPIKeyHandler(apiKeyService)
 	r.Route("/admin", func(r chi.Router) {
 		r.Route("/reservations", func(r chi.Router) {
+			r.Use(scope(apikey.ScopeReservationsAdmin))
 			r.Post("/sync-expired", reservationHandler.SyncExpired)
+			r.Post("/{id}/cancel", reservationHandler.AdminCancel)
+		})
+		r.Route("/carts", func(r chi.Router) {
+			r.Use(scope(apikey.ScopeReservationsAdmin))
+			r.Post("/{id}/cancel", cartHandler.AdminCancel)
+		})
+		r.Route("/raffles", func(r chi.Router) {
+			r.Use(scope(apikey.ScopeReservationsAdmin))
+			r.Post("/{id}/close", raffleHandler.Close) // зафиксировать участников
+			r.Post("/{id}/draw", raffleHandler.Draw)
+		})
+		r.Route("/outbox", func(r chi.Router) {
+			r.Use(scope(apikey.ScopeOutboxReplay))
+			r.Get("/dead", outboxHandler.ListDead)
+			r.Post("/{id}/replay", outboxHandler.Replay)
+		})
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Use(scope(apikey.ScopeKeysAdmin))
+			r.Post("/", apiKeyHandler.Create)
+			r.Get("/", apiKeyHandler.List)
+			r.Post("/{id}/rotate", apiKeyHandler.Rotate) // новый ключ, старый живёт grace_seconds
+			r.Post("/{id}/revoke", apiKeyHandler.Revoke)
 		})
+		r.With(scope(apikey.ScopeKeysAdmin)).Get("/audit-log", apiKeyHandler.ListAudit)
 	})
 
 	return r
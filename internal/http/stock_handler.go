@@ -0,0 +1,165 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"flash-sale-reservation/internal/stock"
+)
+
+const (
+	sseHeartbeat       = 15 * time.Second
+	maxStreamProducts  = 50
+	stockStreamEvent   = "stock"
+	stockStreamRetryMS = 2000
+)
+
+type StockStreamHandler struct {
+	feed *stock.Feed
+}
+
+func NewStockStreamHandler(feed *stock.Feed) *StockStreamHandler {
+	return &StockStreamHandler{feed: feed}
+}
+
+// GET /products/{id}/stream
+func (h *StockStreamHandler) StreamOne(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidInput, "invalid product id")
+		return
+	}
+
+	h.stream(w, r, []int64{id})
+}
+
+// GET /products/stream?ids=1,2,3
+func (h *StockStreamHandler) StreamMany(w http.ResponseWriter, r *http.Request) {
+	var ids []int64
+	seen := make(map[int64]bool)
+
+	for _, v := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			writeProblem(w, r, http.StatusBadRequest, codeInvalidInput, "invalid product id: "+v)
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 || len(ids) > maxStreamProducts {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidInput, fmt.Sprintf("ids must contain 1..%d products", maxStreamProducts))
+		return
+	}
+
+	h.stream(w, r, ids)
+}
+
+// stream sends current levels (or only those newer than Last-Event-ID on
+// resume) and then live updates, with a comment line as heartbeat.
+func (h *StockStreamHandler) stream(w http.ResponseWriter, r *http.Request, productIDs []int64) {
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+
+	var lastEventID int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastEventID, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	// подписываемся до чтения снапшотов, чтобы не пропустить обновление между ними
+	sub := h.feed.Subscribe(productIDs)
+	defer h.feed.Unsubscribe(sub)
+
+	snapshots, err := h.feed.Snapshots(ctx, productIDs)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", stockStreamRetryMS)
+
+	// последний отправленный seq по товару — отбрасываем дубли и устаревшее
+	sent := make(map[int64]int64, len(productIDs))
+
+	for _, u := range snapshots {
+		if lastEventID > 0 && u.Seq <= lastEventID {
+			sent[u.ProductID] = u.Seq
+			continue
+		}
+		if err := writeStockEvent(w, u); err != nil {
+			return
+		}
+		sent[u.ProductID] = u.Seq
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case u, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if u.Seq <= sent[u.ProductID] {
+				continue
+			}
+			if err := writeStockEvent(w, u); err != nil {
+				return
+			}
+			sent[u.ProductID] = u.Seq
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeStockEvent(w http.ResponseWriter, u stock.Update) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	// снапшот из БД ещё не имеет seq — без id, чтобы не сбить Last-Event-ID клиента
+	if u.Seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", u.Seq); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", stockStreamEvent, data)
+	return err
+}
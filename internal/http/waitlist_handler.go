@@ -0,0 +1,96 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"flash-sale-reservation/internal/reservation"
+)
+
+type WaitlistHandler struct {
+	service *reservation.Service
+}
+
+func NewWaitlistHandler(service *reservation.Service) *WaitlistHandler {
+	return &WaitlistHandler{service: service}
+}
+
+// POST /products/{id}/waitlist
+func (h *WaitlistHandler) Join(w http.ResponseWriter, r *http.Request) {
+	productID, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	var req struct {
+		UserID   int64 `json:"user_id"`
+		Quantity int   `json:"quantity"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+		return
+	}
+
+	userID, err := tokenUserID(r, req.UserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	entry, err := h.service.JoinWaitlist(r.Context(), productID, userID, req.Quantity)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeWaitlistEntry(w, http.StatusAccepted, entry)
+}
+
+// GET /waitlist/{id} — только своя запись
+func (h *WaitlistHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	userID, err := tokenUserID(r, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	entry, err := h.service.GetWaitlistEntry(r.Context(), id, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeWaitlistEntry(w, http.StatusOK, entry)
+}
+
+// POST /waitlist/{id}/cancel
+func (h *WaitlistHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+
+	userID, err := tokenUserID(r, 0)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	entry, err := h.service.CancelWaitlistEntry(r.Context(), id, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeWaitlistEntry(w, http.StatusOK, entry)
+}
+
+func writeWaitlistEntry(w http.ResponseWriter, status int, entry *reservation.WaitlistEntry) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(entry)
+}
@@ -0,0 +1,19 @@
+package idempotency
+
+import "time"
+
+const (
+	StatusInProgress = "IN_PROGRESS"
+	StatusCompleted  = "COMPLETED"
+)
+
+type Record struct {
+	Scope          string
+	Key            string
+	Fingerprint    string
+	Status         string
+	ResponseStatus int
+	ContentType    string
+	ResponseBody   []byte
+	CreatedAt      time.Time
+}
@@ -0,0 +1,45 @@
+package idempotency
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Purger periodically deletes keys older than the retention period
+type Purger struct {
+	repo      *Repository
+	interval  time.Duration
+	retention time.Duration
+}
+
+func NewPurger(repo *Repository, interval, retention time.Duration) *Purger {
+	return &Purger{
+		repo:      repo,
+		interval:  interval,
+		retention: retention,
+	}
+}
+
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := p.repo.Purge(ctx, time.Now().Add(-p.retention))
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("idempotency purge failed: %v", err)
+				}
+				continue
+			}
+			if n > 0 {
+				log.Printf("idempotency purge: deleted=%d", n)
+			}
+		}
+	}
+}
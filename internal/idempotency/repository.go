@@ -0,0 +1,137 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Acquire claims (scope, key) for a new request. It returns owned = true
+// when the caller should execute the request, otherwise the existing
+// record. An IN_PROGRESS record older than lockTimeout with the same
+// fingerprint is considered abandoned (the process died) and is taken over.
+func (r *Repository) Acquire(
+	ctx context.Context,
+	scope, key, fingerprint string,
+	lockTimeout time.Duration,
+) (owned bool, existing *Record, err error) {
+
+	query := `
+		INSERT INTO idempotency_keys (scope, key, fingerprint, status)
+		VALUES ($1, $2, $3, 'IN_PROGRESS')
+		ON CONFLICT (scope, key) DO UPDATE
+			SET created_at = now()
+			WHERE idempotency_keys.status = 'IN_PROGRESS'
+			  AND idempotency_keys.fingerprint = EXCLUDED.fingerprint
+			  AND idempotency_keys.created_at < now() - make_interval(secs => $4)
+		RETURNING scope
+	`
+
+	var s string
+	err = r.db.QueryRowContext(ctx, query, scope, key, fingerprint, lockTimeout.Seconds()).Scan(&s)
+	if err == nil {
+		return true, nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, nil, err
+	}
+
+	existing, err = r.Get(ctx, scope, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		// запись удалили между запросами — пусть клиент повторит
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+
+	return false, existing, nil
+}
+
+func (r *Repository) Get(ctx context.Context, scope, key string) (*Record, error) {
+
+	query := `
+		SELECT scope, key, fingerprint, status,
+		       COALESCE(response_status, 0), COALESCE(content_type, ''), response_body,
+		       created_at
+		FROM idempotency_keys
+		WHERE scope = $1 AND key = $2
+	`
+
+	var rec Record
+	err := r.db.QueryRowContext(ctx, query, scope, key).Scan(
+		&rec.Scope,
+		&rec.Key,
+		&rec.Fingerprint,
+		&rec.Status,
+		&rec.ResponseStatus,
+		&rec.ContentType,
+		&rec.ResponseBody,
+		&rec.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rec, nil
+}
+
+// Complete stores the response to be replayed for duplicates
+func (r *Repository) Complete(
+	ctx context.Context,
+	scope, key string,
+	status int,
+	contentType string,
+	body []byte,
+) error {
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = 'COMPLETED',
+		    response_status = $3,
+		    content_type = $4,
+		    response_body = $5,
+		    completed_at = now()
+		WHERE scope = $1 AND key = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, scope, key, status, contentType, body)
+	return err
+}
+
+// Release forgets the key so the request can be retried (used after 5xx)
+func (r *Repository) Release(ctx context.Context, scope, key string) error {
+
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND key = $2 AND status = 'IN_PROGRESS'
+	`
+
+	_, err := r.db.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+// Purge deletes keys created before the given time
+func (r *Repository) Purge(ctx context.Context, before time.Time) (int64, error) {
+
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE created_at < $1
+	`
+
+	res, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,153 @@
+// Package inventory keeps a Redis-side copy of product stock so that
+// sold-out requests are rejected before they touch PostgreSQL.
+//
+// PostgreSQL stays the source of truth: the gate only filters, and
+// DecreaseStockTx still has the final word. Counters are seeded lazily
+// from products.stock and compensated whenever a held unit comes back.
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash-sale-reservation/internal/product"
+)
+
+const keyPrefix = "inventory:stock:"
+
+// ErrSoldOut is the same error PostgreSQL path returns for missing stock
+var ErrSoldOut = product.ErrOutOfStock
+
+// результаты reserveScript
+const (
+	resultMissing = -1
+	resultSoldOut = -2
+)
+
+// reserveScript atomically takes ARGV[1] units if that many are left.
+var reserveScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if not v then
+	return -1
+end
+local n = tonumber(ARGV[1])
+if tonumber(v) < n then
+	return -2
+end
+return redis.call('DECRBY', KEYS[1], n)
+`)
+
+// releaseScript returns units only to an existing counter: a missing one
+// will be seeded from PostgreSQL, which already includes them.
+var releaseScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+return redis.call('INCRBY', KEYS[1], ARGV[1])
+`)
+
+type Gate struct {
+	redis       *redis.Client
+	productRepo *product.Repository
+}
+
+func NewGate(redis *redis.Client, productRepo *product.Repository) *Gate {
+	return &Gate{
+		redis:       redis,
+		productRepo: productRepo,
+	}
+}
+
+func Key(productID int64) string {
+	return fmt.Sprintf("%s%d", keyPrefix, productID)
+}
+
+// Reserve takes n units from the counter. It returns ErrSoldOut when
+// fewer than n are left; any other error means Redis is unavailable and
+// the caller should fall through to PostgreSQL without a hold on the gate.
+func (g *Gate) Reserve(ctx context.Context, productID int64, n int) error {
+	key := Key(productID)
+
+	for seeded := false; ; seeded = true {
+		left, err := reserveScript.Run(ctx, g.redis, []string{key}, n).Int64()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case left == resultSoldOut:
+			return ErrSoldOut
+		case left == resultMissing && !seeded:
+			if err := g.seedFromDB(ctx, productID); err != nil {
+				return err
+			}
+		case left == resultMissing:
+			return errors.New("inventory counter missing after seed")
+		default:
+			return nil
+		}
+	}
+}
+
+// Available returns how many units the counter has left, seeding it
+// first if missing. An error means the gate can't tell; ask PostgreSQL.
+func (g *Gate) Available(ctx context.Context, productID int64) (int, error) {
+	key := Key(productID)
+
+	for seeded := false; ; seeded = true {
+		n, err := g.redis.Get(ctx, key).Int()
+		switch {
+		case errors.Is(err, redis.Nil) && !seeded:
+			if err := g.seedFromDB(ctx, productID); err != nil {
+				return 0, err
+			}
+		case errors.Is(err, redis.Nil):
+			return 0, errors.New("inventory counter missing after seed")
+		default:
+			return n, err
+		}
+	}
+}
+
+// Release returns n units to the counter
+func (g *Gate) Release(ctx context.Context, productID int64, n int) error {
+	return releaseScript.Run(ctx, g.redis, []string{Key(productID)}, n).Err()
+}
+
+// Set overwrites the counter, e.g. during reconciliation
+func (g *Gate) Set(ctx context.Context, productID int64, stock int) error {
+	return g.redis.Set(ctx, Key(productID), stock, 0).Err()
+}
+
+// SeedAll creates counters for products that don't have one yet.
+// Existing counters are left alone: other instances may be using them.
+func (g *Gate) SeedAll(ctx context.Context) error {
+	products, err := g.productRepo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		if err := g.redis.SetNX(ctx, Key(p.ID), p.Stock, 0).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Gate) seedFromDB(ctx context.Context, productID int64) error {
+	levels, err := g.productRepo.GetStockLevels(ctx, []int64{productID})
+	if err != nil {
+		return err
+	}
+	if len(levels) == 0 {
+		// несуществующий товар — пусть ответит БД
+		return errors.New("product not found")
+	}
+
+	return g.redis.SetNX(ctx, Key(productID), levels[0].Stock, 0).Err()
+}
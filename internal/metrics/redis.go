@@ -5,4 +5,6 @@ const (
 	ReservationsConfirmed = "metrics:reservations:confirmed"
 	ReservationsCanceled  = "metrics:reservations:canceled"
 	ReservationsExpired   = "metrics:reservations:expired"
+	// ReservationsExtended не сверяется reconcile: продление не меняет статус
+	ReservationsExtended = "metrics:reservations:extended"
 )
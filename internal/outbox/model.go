@@ -0,0 +1,18 @@
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Event struct {
+	ID             int64           `json:"id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      *string         `json:"last_error,omitempty"`
+	PublishedAt    *time.Time      `json:"published_at,omitempty"`
+	DeadLetteredAt *time.Time      `json:"dead_lettered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
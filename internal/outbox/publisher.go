@@ -0,0 +1,21 @@
+package outbox
+
+import (
+	"context"
+	"log"
+)
+
+// Publisher delivers a single outbox event to the outside world.
+// A non-nil error means the event was not delivered and will be retried.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// LogPublisher only writes events to the log. Used when no real
+// transport is configured.
+type LogPublisher struct{}
+
+func (LogPublisher) Publish(_ context.Context, event Event) error {
+	log.Printf("outbox: %s #%d %s", event.EventType, event.ID, event.Payload)
+	return nil
+}
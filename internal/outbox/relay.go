@@ -0,0 +1,195 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultLease — аренда батча, если RelayConfig.Lease не задан
+const DefaultLease = 5 * time.Minute
+
+type RelayConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// после MaxAttempts неудачных попыток событие уходит в dead-letter
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// на сколько relay забирает батч; если процесс упал, через Lease
+	// события возьмёт другой
+	Lease time.Duration
+}
+
+// RelayStore is the outbox table as the relay sees it; Repository is the
+// PostgreSQL one. Lease and retry times are counted by the store's clock,
+// not the relay's.
+type RelayStore interface {
+	// Claim leases up to limit events due now, from the head of the queue
+	// up to the first one that isn't due; nil when another relay is
+	// claiming at the same time
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]Event, error)
+	// Settle records the outcomes and ends the lease of release
+	Settle(ctx context.Context, outcomes []Outcome, release []int64) error
+}
+
+// Outcome is the result of publishing one claimed event
+type Outcome struct {
+	EventID int64
+	// Err is empty when the event was delivered
+	Err string
+	// Dead — попытки кончились, событие уходит в dead-letter
+	Dead bool
+	// RetryIn is the backoff before the next attempt
+	RetryIn time.Duration
+}
+
+// Relay polls outbox_events and hands them to a Publisher in id order.
+//
+// Delivery is at-least-once: an event is marked published only after
+// Publish returns nil, so a crash in between means it is sent again once
+// its lease runs out.
+// A failing event blocks the ones after it until it is either delivered
+// or dead-lettered, which keeps ordering intact.
+type Relay struct {
+	store     RelayStore
+	publisher Publisher
+	cfg       RelayConfig
+}
+
+func NewRelay(store RelayStore, publisher Publisher, cfg RelayConfig) *Relay {
+	if cfg.Lease <= 0 {
+		cfg.Lease = DefaultLease
+	}
+
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+// Run polls until ctx is canceled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	log.Printf("outbox relay started, interval=%s batch=%d", r.cfg.PollInterval, r.cfg.BatchSize)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("outbox relay stopped")
+			return
+		case <-ticker.C:
+			// пока батчи приходят полными — не ждём следующий тик
+			for {
+				n, err := r.ProcessBatch(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("outbox relay: %v", err)
+					}
+					break
+				}
+				if n < r.cfg.BatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// ProcessBatch publishes up to BatchSize pending events and returns how
+// many of them were published.
+//
+// No transaction or lock is held while publishing: the events are claimed
+// with a lease (see Repository.Claim), published, and the results are
+// recorded with Settle.
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+
+	events, err := r.store.Claim(ctx, r.cfg.BatchSize, r.cfg.Lease)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	// новые события начинаем не позже половины аренды, а одна публикация
+	// длится не дольше трёх четвертей: иначе срок аренды выйдет, событие
+	// возьмёт и отправит ещё раз другой relay. Последняя четверть — на Settle.
+	claimed := time.Now()
+	deadline := claimed.Add(r.cfg.Lease / 2)
+	publishBy := claimed.Add(r.cfg.Lease * 3 / 4)
+
+	var (
+		outcomes  []Outcome
+		published int
+	)
+	for _, event := range events {
+		if time.Now().After(deadline) {
+			break
+		}
+
+		pubCtx, cancel := context.WithDeadline(ctx, publishBy)
+		pubErr := r.publisher.Publish(pubCtx, event)
+		cancel()
+		if pubErr != nil && ctx.Err() != nil {
+			// остановка сервиса — не неудачная попытка
+			break
+		}
+
+		o := r.outcome(event, pubErr)
+		outcomes = append(outcomes, o)
+		if pubErr == nil {
+			published++
+		}
+
+		// ошибка, после которой событие ещё повторяется, держит очередь
+		if pubErr != nil && !o.Dead {
+			break
+		}
+	}
+
+	var release []int64
+	for _, event := range events[len(outcomes):] {
+		release = append(release, event.ID)
+	}
+
+	// результаты записываем и при отмене ctx: иначе опубликованное уйдёт повторно
+	if err := r.store.Settle(context.WithoutCancel(ctx), outcomes, release); err != nil {
+		return 0, err
+	}
+
+	return published, ctx.Err()
+}
+
+// outcome decides what happens to an event after an attempt
+func (r *Relay) outcome(event Event, pubErr error) Outcome {
+	o := Outcome{EventID: event.ID}
+	if pubErr == nil {
+		return o
+	}
+
+	o.Err = pubErr.Error()
+	attempts := event.Attempts + 1
+
+	if attempts >= r.cfg.MaxAttempts {
+		o.Dead = true
+		log.Printf("outbox relay: event %d dead-lettered after %d attempts: %v", event.ID, attempts, pubErr)
+		return o
+	}
+
+	o.RetryIn = r.backoff(attempts)
+	log.Printf("outbox relay: event %d attempt %d failed, retry in %s: %v", event.ID, attempts, o.RetryIn, pubErr)
+	return o
+}
+
+// backoff = BaseBackoff * 2^(attempts-1), но не больше MaxBackoff
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= r.cfg.MaxBackoff {
+			return r.cfg.MaxBackoff
+		}
+	}
+	return d
+}
@@ -0,0 +1,224 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a RelayStore kept in memory. Like Repository it hands
+// out the due head of the queue and leases it by moving NextAttemptAt.
+type memoryStore struct {
+	mu     sync.Mutex
+	events []*Event
+	leases []time.Duration
+	dead   map[int64]bool
+}
+
+func newMemoryStore(n int) *memoryStore {
+	s := &memoryStore{dead: map[int64]bool{}}
+	for i := 1; i <= n; i++ {
+		s.events = append(s.events, &Event{ID: int64(i), EventType: "StockChanged"})
+	}
+	return s
+}
+
+func (s *memoryStore) Claim(_ context.Context, limit int, lease time.Duration) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.leases = append(s.leases, lease)
+	now := time.Now()
+
+	var claimed []Event
+	for _, e := range s.events {
+		if e.PublishedAt != nil || s.dead[e.ID] {
+			continue
+		}
+		if e.NextAttemptAt.After(now) || len(claimed) == limit {
+			break
+		}
+		claimed = append(claimed, *e)
+		e.NextAttemptAt = now.Add(lease)
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) Settle(_ context.Context, outcomes []Outcome, release []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, o := range outcomes {
+		e := s.event(o.EventID)
+		e.Attempts++
+		switch {
+		case o.Err == "":
+			e.PublishedAt = &now
+		case o.Dead:
+			s.dead[e.ID] = true
+		default:
+			e.NextAttemptAt = now.Add(o.RetryIn)
+		}
+	}
+	for _, id := range release {
+		s.event(id).NextAttemptAt = now
+	}
+	return nil
+}
+
+func (s *memoryStore) event(id int64) *Event {
+	for _, e := range s.events {
+		if e.ID == id {
+			return e
+		}
+	}
+	panic("no event")
+}
+
+// scriptedPublisher fails the events in fail and sleeps delay per event
+type scriptedPublisher struct {
+	fail      map[int64]bool
+	delay     time.Duration
+	published []int64
+}
+
+func (p *scriptedPublisher) Publish(_ context.Context, event Event) error {
+	time.Sleep(p.delay)
+	if p.fail[event.ID] {
+		return errors.New("subscriber is down")
+	}
+	p.published = append(p.published, event.ID)
+	return nil
+}
+
+func TestRelayLease(t *testing.T) {
+	store := newMemoryStore(3)
+	pub := &scriptedPublisher{delay: 30 * time.Millisecond}
+	relay := NewRelay(store, pub, RelayConfig{BatchSize: 10, MaxAttempts: 3, Lease: 40 * time.Millisecond})
+
+	// за половину аренды (20ms) успевает только первое событие
+	n, err := relay.ProcessBatch(context.Background())
+	if err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+	if n != 1 || len(pub.published) != 1 {
+		t.Fatalf("published %d (%v), want 1", n, pub.published)
+	}
+	if store.leases[0] != 40*time.Millisecond {
+		t.Errorf("claimed with lease %s, want 40ms", store.leases[0])
+	}
+
+	// остаток возвращён и сразу достаётся следующему проходу
+	for _, e := range store.events[1:] {
+		if e.Attempts != 0 || e.NextAttemptAt.After(time.Now()) {
+			t.Errorf("event %d: attempts %d, next attempt %s, want released", e.ID, e.Attempts, e.NextAttemptAt)
+		}
+	}
+
+	// пока аренда не вышла, второй relay событий не получает
+	store.events[1].NextAttemptAt = time.Now().Add(time.Hour)
+	other := NewRelay(store, &scriptedPublisher{}, RelayConfig{BatchSize: 10, MaxAttempts: 3})
+	if n, err := other.ProcessBatch(context.Background()); err != nil || n != 0 {
+		t.Errorf("second relay published %d (err %v) during a lease, want 0", n, err)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	store := newMemoryStore(3)
+	pub := &scriptedPublisher{fail: map[int64]bool{2: true}}
+	relay := NewRelay(store, pub, RelayConfig{
+		BatchSize:   10,
+		MaxAttempts: 5,
+		BaseBackoff: time.Hour,
+		MaxBackoff:  4 * time.Hour,
+	})
+
+	n, err := relay.ProcessBatch(context.Background())
+	if err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("published %d, want 1", n)
+	}
+
+	failed := store.events[1]
+	if failed.Attempts != 1 || time.Until(failed.NextAttemptAt) < 59*time.Minute {
+		t.Errorf("failed event: attempts %d, next attempt in %s, want 1 and ~1h", failed.Attempts, time.Until(failed.NextAttemptAt))
+	}
+	// событие за неудачным не пробовали: порядок сохраняется
+	if after := store.events[2]; after.Attempts != 0 || after.PublishedAt != nil {
+		t.Errorf("event after the failed one was attempted")
+	}
+	if n, _ := relay.ProcessBatch(context.Background()); n != 0 {
+		t.Errorf("published %d while the head waits for backoff, want 0", n)
+	}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Hour},
+		{2, 2 * time.Hour},
+		{3, 4 * time.Hour},
+		{10, 4 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRelayDeadLetter(t *testing.T) {
+	store := newMemoryStore(2)
+	store.events[0].Attempts = 2
+	pub := &scriptedPublisher{fail: map[int64]bool{1: true}}
+	relay := NewRelay(store, pub, RelayConfig{BatchSize: 10, MaxAttempts: 3, BaseBackoff: time.Hour})
+
+	n, err := relay.ProcessBatch(context.Background())
+	if err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+
+	if !store.dead[1] || store.events[0].Attempts != 3 {
+		t.Errorf("event 1: dead %v, attempts %d, want dead after 3", store.dead[1], store.events[0].Attempts)
+	}
+	// dead-letter очередь не держит
+	if n != 1 || store.events[1].PublishedAt == nil {
+		t.Errorf("published %d, event 2 published %v, want the next event delivered", n, store.events[1].PublishedAt != nil)
+	}
+}
+
+// blockingPublisher hangs until its ctx is done
+type blockingPublisher struct{}
+
+func (blockingPublisher) Publish(ctx context.Context, _ Event) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRelayBoundsPublishByLease(t *testing.T) {
+	store := newMemoryStore(1)
+	relay := NewRelay(store, blockingPublisher{}, RelayConfig{
+		BatchSize:   10,
+		MaxAttempts: 3,
+		BaseBackoff: time.Hour,
+		Lease:       80 * time.Millisecond,
+	})
+
+	started := time.Now()
+	if _, err := relay.ProcessBatch(context.Background()); err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+
+	// публикация оборвана до конца аренды, попытка засчитана как неудачная
+	if took := time.Since(started); took >= 80*time.Millisecond {
+		t.Errorf("ProcessBatch took %s, longer than the lease", took)
+	}
+	if e := store.events[0]; e.Attempts != 1 || e.PublishedAt != nil {
+		t.Errorf("event: attempts %d, published %v, want one failed attempt", e.Attempts, e.PublishedAt != nil)
+	}
+}
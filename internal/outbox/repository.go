@@ -4,6 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"time"
+
+	"flash-sale-reservation/internal/events"
 )
 
 type Repository struct {
@@ -14,14 +17,20 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// InsertTx validates payload against its JSON Schema and stores it
+// wrapped in a CloudEvents envelope
 func (r *Repository) InsertTx(
 	ctx context.Context,
 	tx *sql.Tx,
-	eventType string,
-	payload any,
+	payload events.Payload,
 ) error {
 
-	data, err := json.Marshal(payload)
+	envelope, err := events.NewEnvelope(payload)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(envelope)
 	if err != nil {
 		return err
 	}
@@ -31,6 +40,301 @@ func (r *Repository) InsertTx(
 		VALUES ($1, $2)
 	`
 
-	_, err = tx.ExecContext(ctx, query, eventType, data)
+	_, err = tx.ExecContext(ctx, query, envelope.Type, data)
+	return err
+}
+
+const eventColumns = `
+	id, event_type, payload, attempts, next_attempt_at,
+	last_error, published_at, dead_lettered_at, created_at
+`
+
+// relayLockKey — ключ advisory lock, чтобы публиковал один relay за раз
+// и порядок по id не нарушался между инстансами
+const relayLockKey = 7_001_004
+
+// TryLockRelayTx takes the transaction-scoped relay lock.
+// Returns false if another relay currently holds it.
+func (r *Repository) TryLockRelayTx(ctx context.Context, tx *sql.Tx) (bool, error) {
+	var locked bool
+	err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, relayLockKey).Scan(&locked)
+	return locked, err
+}
+
+// Claim leases up to limit due events for lease in one short transaction.
+// Returns nil if another relay is claiming right now.
+func (r *Repository) Claim(ctx context.Context, limit int, lease time.Duration) ([]Event, error) {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	locked, err := r.TryLockRelayTx(ctx, tx)
+	if err != nil || !locked {
+		return nil, err
+	}
+
+	events, err := r.FetchPendingTx(ctx, tx, limit)
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	if err := r.ClaimTx(ctx, tx, ids, lease); err != nil {
+		return nil, err
+	}
+
+	return events, tx.Commit()
+}
+
+// Settle records the outcomes of published events and ends the lease of
+// the claimed events in release, in one transaction
+func (r *Repository) Settle(ctx context.Context, outcomes []Outcome, release []int64) error {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, o := range outcomes {
+		switch {
+		case o.Err == "":
+			err = r.MarkPublishedTx(ctx, tx, o.EventID)
+		case o.Dead:
+			err = r.MarkDeadTx(ctx, tx, o.EventID, o.Err)
+		default:
+			err = r.MarkFailedTx(ctx, tx, o.EventID, o.Err, o.RetryIn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(release) > 0 {
+		if err := r.ReleaseTx(ctx, tx, release); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FetchPendingTx returns the events due now in id order: the head of the
+// queue up to the first unpublished event that waits for its backoff or
+// is leased, so the ones after it wait too and the order holds. Due is
+// decided by the database clock, the one next_attempt_at is written with.
+// The rows are locked FOR NO KEY UPDATE: it is enough against a second
+// relay, and unlike FOR UPDATE it lets inserts referencing the events
+// (webhook_deliveries, on another connection) take their FOR KEY SHARE.
+func (r *Repository) FetchPendingTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	limit int,
+) ([]Event, error) {
+
+	query := `
+		WITH blocked AS (
+			SELECT min(id) AS id
+			FROM outbox_events
+			WHERE published_at IS NULL
+			  AND dead_lettered_at IS NULL
+			  AND next_attempt_at > now()
+		)
+		SELECT ` + eventColumns + `
+		FROM outbox_events
+		WHERE published_at IS NULL
+		  AND dead_lettered_at IS NULL
+		  AND next_attempt_at <= now()
+		  AND NOT EXISTS (SELECT 1 FROM blocked WHERE blocked.id < outbox_events.id)
+		ORDER BY id
+		LIMIT $1
+		FOR NO KEY UPDATE
+	`
+
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
+}
+
+// ClaimTx leases events to this relay for lease by moving their
+// next_attempt_at: other relays see the head of the queue not due yet and
+// wait, so events can be published outside a transaction. If the relay
+// dies, the lease runs out and the events are picked up again.
+func (r *Repository) ClaimTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	ids []int64,
+	lease time.Duration,
+) error {
+
+	query := `
+		UPDATE outbox_events
+		SET next_attempt_at = now() + make_interval(secs => $2)
+		WHERE id = ANY($1)
+	`
+
+	_, err := tx.ExecContext(ctx, query, ids, lease.Seconds())
+	return err
+}
+
+// ReleaseTx ends the lease of claimed events that were not attempted
+func (r *Repository) ReleaseTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	ids []int64,
+) error {
+
+	query := `
+		UPDATE outbox_events
+		SET next_attempt_at = now()
+		WHERE id = ANY($1)
+		  AND published_at IS NULL
+		  AND dead_lettered_at IS NULL
+	`
+
+	_, err := tx.ExecContext(ctx, query, ids)
+	return err
+}
+
+func (r *Repository) MarkPublishedTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+) error {
+
+	query := `
+		UPDATE outbox_events
+		SET published_at = now(),
+		    attempts = attempts + 1,
+		    last_error = NULL
+		WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+// MarkFailedTx records a failed attempt and schedules the next one in
+// retryIn
+func (r *Repository) MarkFailedTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+	lastError string,
+	retryIn time.Duration,
+) error {
+
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1,
+		    last_error = $2,
+		    next_attempt_at = now() + make_interval(secs => $3)
+		WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, id, lastError, retryIn.Seconds())
+	return err
+}
+
+// MarkDeadTx moves a poison event to the dead-letter state
+func (r *Repository) MarkDeadTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+	lastError string,
+) error {
+
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1,
+		    last_error = $2,
+		    dead_lettered_at = now()
+		WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, id, lastError)
 	return err
 }
+
+// ListDead returns dead-lettered events, newest first
+func (r *Repository) ListDead(
+	ctx context.Context,
+	limit int,
+	offset int,
+) ([]Event, error) {
+
+	query := `
+		SELECT ` + eventColumns + `
+		FROM outbox_events
+		WHERE dead_lettered_at IS NOT NULL
+		ORDER BY id DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
+}
+
+// Requeue returns a dead-lettered event to the relay with a fresh attempt counter.
+// Returns false if there is no such dead-lettered event.
+func (r *Repository) Requeue(ctx context.Context, id int64) (bool, error) {
+
+	query := `
+		UPDATE outbox_events
+		SET dead_lettered_at = NULL,
+		    attempts = 0,
+		    next_attempt_at = now()
+		WHERE id = $1
+		  AND dead_lettered_at IS NOT NULL
+	`
+
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func scanEvents(rows *sql.Rows) ([]Event, error) {
+	var result []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(
+			&e.ID,
+			&e.EventType,
+			&e.Payload,
+			&e.Attempts,
+			&e.NextAttemptAt,
+			&e.LastError,
+			&e.PublishedAt,
+			&e.DeadLetteredAt,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+
+	return result, rows.Err()
+}
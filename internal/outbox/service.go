@@ -0,0 +1,41 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFound     = errors.New("dead-lettered event not found")
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func (s *Service) ListDead(ctx context.Context, limit, offset int) ([]Event, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("%w: limit must be > 0", ErrInvalidInput)
+	}
+
+	return s.repo.ListDead(ctx, limit, offset)
+}
+
+// Replay puts a dead-lettered event back into the relay queue
+func (s *Service) Replay(ctx context.Context, id int64) error {
+	ok, err := s.repo.Requeue(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	return nil
+}
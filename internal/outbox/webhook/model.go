@@ -0,0 +1,17 @@
+package webhook
+
+import "time"
+
+// Delivery is one HTTP attempt to deliver an event to one subscriber
+type Delivery struct {
+	ID         int64     `json:"id"`
+	EventID    int64     `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	URL        string    `json:"url"`
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"status_code,omitempty"`
+	Error      *string   `json:"error,omitempty"`
+	Succeeded  bool      `json:"succeeded"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,241 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash-sale-reservation/internal/events"
+	"flash-sale-reservation/internal/outbox"
+)
+
+const (
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderEventType = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+type Config struct {
+	// event_type → URL подписчиков
+	Subscribers map[string][]string
+	// общий секрет для HMAC-SHA256 подписи
+	Secret string
+	// попыток на одного подписчика внутри одного Publish
+	MaxAttempts int
+	BaseBackoff time.Duration
+}
+
+// DeliveryLog records delivery attempts. Repository is the Postgres
+// implementation; nil disables logging and duplicate suppression.
+type DeliveryLog interface {
+	Record(ctx context.Context, d Delivery) error
+	Delivered(ctx context.Context, eventID int64, url string) (bool, error)
+}
+
+// Publisher is an outbox.Publisher that POSTs event payloads to HTTP
+// subscribers.
+//
+// Each request is signed: X-Webhook-Signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), where
+// timestamp is the X-Webhook-Timestamp header (unix seconds). Receivers
+// should reject stale timestamps and dedupe on X-Webhook-Id.
+type Publisher struct {
+	cfg        Config
+	client     *http.Client
+	deliveries DeliveryLog
+}
+
+func NewPublisher(cfg Config, client *http.Client, deliveries DeliveryLog) *Publisher {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+
+	return &Publisher{
+		cfg:        cfg,
+		client:     client,
+		deliveries: deliveries,
+	}
+}
+
+// Publish delivers the event to every subscriber of its type. Subscribers
+// that already got it on a previous relay attempt are skipped, so a
+// failure of one endpoint does not spam the others.
+func (p *Publisher) Publish(ctx context.Context, event outbox.Event) error {
+	var errs []error
+
+	for _, url := range p.cfg.Subscribers[event.EventType] {
+		if p.deliveries != nil {
+			done, err := p.deliveries.Delivered(ctx, event.ID, url)
+			if err != nil {
+				return err
+			}
+			if done {
+				continue
+			}
+		}
+
+		if err := p.deliver(ctx, event, url); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *Publisher) deliver(ctx context.Context, event outbox.Event, url string) error {
+	var lastErr error
+
+	for attempt := 1; attempt <= p.cfg.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			backoff := p.cfg.BaseBackoff << (attempt - 2)
+			// ctx relay'я ограничен арендой события: повтор, который в неё
+			// не влезет, оставляем backoff'у relay'я
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		statusCode, err := p.send(ctx, event, url, attempt)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		// 4xx (кроме 408 и 429) — подписчик отверг запрос, повтор не поможет
+		if statusCode >= 400 && statusCode < 500 &&
+			statusCode != http.StatusRequestTimeout &&
+			statusCode != http.StatusTooManyRequests {
+			break
+		}
+	}
+
+	return lastErr
+}
+
+func (p *Publisher) send(ctx context.Context, event outbox.Event, url string, attempt int) (int, error) {
+	started := time.Now()
+	timestamp := strconv.FormatInt(started.Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(event.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	// payload уже CloudEvents-конверт — structured mode
+	req.Header.Set("Content-Type", events.ContentType)
+	req.Header.Set(HeaderEventID, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(HeaderEventType, event.EventType)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(p.cfg.Secret, timestamp, event.Payload))
+
+	statusCode := 0
+	resp, err := p.client.Do(req)
+	if err == nil {
+		statusCode = resp.StatusCode
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		if statusCode < 200 || statusCode >= 300 {
+			err = fmt.Errorf("unexpected status %d", statusCode)
+		}
+	}
+
+	p.record(ctx, Delivery{
+		EventID:    event.ID,
+		EventType:  event.EventType,
+		URL:        url,
+		Attempt:    attempt,
+		StatusCode: nonZero(statusCode),
+		Error:      errString(err),
+		Succeeded:  err == nil,
+		DurationMS: time.Since(started).Milliseconds(),
+	})
+
+	return statusCode, err
+}
+
+func (p *Publisher) record(ctx context.Context, d Delivery) {
+	if p.deliveries == nil {
+		return
+	}
+	// попытку пишем и когда ctx уже истёк по сроку аренды
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	// ошибка записи не роняет доставку, но без записи успешная доставка
+	// повторится на следующей попытке relay — поэтому её видно в логе
+	if err := p.deliveries.Record(ctx, d); err != nil {
+		log.Printf("webhook: record delivery of event %d to %s: %v", d.EventID, d.URL, err)
+	}
+}
+
+// Sign returns the X-Webhook-Signature value for a request body
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign in constant time
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// ParseSubscribers parses "EventA=url1,url2;EventB=url3"
+func ParseSubscribers(s string) (map[string][]string, error) {
+	subscribers := make(map[string][]string)
+
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		eventType, urls, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(eventType) == "" {
+			return nil, fmt.Errorf("invalid subscriber entry %q", part)
+		}
+
+		for _, url := range strings.Split(urls, ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				key := strings.TrimSpace(eventType)
+				subscribers[key] = append(subscribers[key], url)
+			}
+		}
+	}
+
+	return subscribers, nil
+}
+
+func nonZero(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+func errString(err error) *string {
+	if err == nil {
+		return nil
+	}
+	s := err.Error()
+	return &s
+}
@@ -0,0 +1,222 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"flash-sale-reservation/internal/events"
+	"flash-sale-reservation/internal/outbox"
+)
+
+// memoryLog is a DeliveryLog kept in memory
+type memoryLog struct {
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+func (l *memoryLog) Record(_ context.Context, d Delivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deliveries = append(l.deliveries, d)
+	return nil
+}
+
+func (l *memoryLog) Delivered(_ context.Context, eventID int64, url string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, d := range l.deliveries {
+		if d.EventID == eventID && d.URL == url && d.Succeeded {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// subscriber answers with statuses in turn (the last one repeats) and
+// keeps the requests it got
+type subscriber struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []received
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func (s *subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, received{header: r.Header.Clone(), body: body})
+	status := s.statuses[min(len(s.requests), len(s.statuses))-1]
+	s.mu.Unlock()
+
+	w.WriteHeader(status)
+}
+
+func (s *subscriber) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func TestPublisherDeliversSignedEvent(t *testing.T) {
+	sub := &subscriber{statuses: []int{http.StatusOK}}
+	srv := httptest.NewServer(sub)
+	defer srv.Close()
+
+	deliveries := &memoryLog{}
+	p := NewPublisher(Config{
+		Subscribers: map[string][]string{"ReservationCreated": {srv.URL}},
+		Secret:      "s3cret",
+		MaxAttempts: 3,
+	}, srv.Client(), deliveries)
+
+	event := outbox.Event{
+		ID:        42,
+		EventType: "ReservationCreated",
+		Payload:   []byte(`{"specversion":"1.0","type":"ReservationCreated"}`),
+	}
+
+	if err := p.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if sub.count() != 1 {
+		t.Fatalf("subscriber got %d requests, want 1", sub.count())
+	}
+
+	req := sub.requests[0]
+	if string(req.body) != string(event.Payload) {
+		t.Errorf("body = %s, want %s", req.body, event.Payload)
+	}
+	if got := req.header.Get("Content-Type"); got != events.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, events.ContentType)
+	}
+	if got := req.header.Get(HeaderEventID); got != "42" {
+		t.Errorf("%s = %q, want 42", HeaderEventID, got)
+	}
+	if got := req.header.Get(HeaderEventType); got != event.EventType {
+		t.Errorf("%s = %q, want %q", HeaderEventType, got, event.EventType)
+	}
+
+	ts := req.header.Get(HeaderTimestamp)
+	if _, err := strconv.ParseInt(ts, 10, 64); err != nil {
+		t.Errorf("%s = %q, want unix seconds", HeaderTimestamp, ts)
+	}
+	if !Verify("s3cret", ts, req.body, req.header.Get(HeaderSignature)) {
+		t.Errorf("signature %q does not verify", req.header.Get(HeaderSignature))
+	}
+
+	if len(deliveries.deliveries) != 1 || !deliveries.deliveries[0].Succeeded {
+		t.Fatalf("deliveries = %+v, want one succeeded", deliveries.deliveries)
+	}
+	if d := deliveries.deliveries[0]; d.EventID != 42 || d.URL != srv.URL || d.StatusCode == nil || *d.StatusCode != http.StatusOK {
+		t.Errorf("delivery = %+v", d)
+	}
+
+	// повтор relay не шлёт событие тому, кто его уже получил
+	if err := p.Publish(context.Background(), event); err != nil {
+		t.Fatalf("second Publish: %v", err)
+	}
+	if sub.count() != 1 {
+		t.Errorf("subscriber got %d requests after a repeat, want 1", sub.count())
+	}
+}
+
+func TestPublisherRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"5xx then ok", []int{http.StatusBadGateway, http.StatusOK}, 2, false},
+		{"429 is retried", []int{http.StatusTooManyRequests, http.StatusOK}, 2, false},
+		{"5xx every time", []int{http.StatusInternalServerError}, 3, true},
+		{"4xx is not retried", []int{http.StatusBadRequest}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := &subscriber{statuses: tt.statuses}
+			srv := httptest.NewServer(sub)
+			defer srv.Close()
+
+			deliveries := &memoryLog{}
+			p := NewPublisher(Config{
+				Subscribers: map[string][]string{"StockChanged": {srv.URL}},
+				MaxAttempts: 3,
+				BaseBackoff: time.Millisecond,
+			}, srv.Client(), deliveries)
+
+			err := p.Publish(context.Background(), outbox.Event{ID: 1, EventType: "StockChanged", Payload: []byte(`{}`)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Publish err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if sub.count() != tt.wantCalls {
+				t.Errorf("subscriber got %d requests, want %d", sub.count(), tt.wantCalls)
+			}
+			if len(deliveries.deliveries) != tt.wantCalls {
+				t.Errorf("%d deliveries recorded, want %d", len(deliveries.deliveries), tt.wantCalls)
+			}
+			for i, d := range deliveries.deliveries {
+				if d.Attempt != i+1 {
+					t.Errorf("delivery %d: attempt %d", i, d.Attempt)
+				}
+			}
+		})
+	}
+}
+
+func TestPublisherSkipsOtherEventTypes(t *testing.T) {
+	sub := &subscriber{statuses: []int{http.StatusOK}}
+	srv := httptest.NewServer(sub)
+	defer srv.Close()
+
+	p := NewPublisher(Config{
+		Subscribers: map[string][]string{"ReservationCreated": {srv.URL}},
+	}, srv.Client(), nil)
+
+	if err := p.Publish(context.Background(), outbox.Event{ID: 1, EventType: "StockChanged", Payload: []byte(`{}`)}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if sub.count() != 0 {
+		t.Errorf("subscriber got %d requests, want 0", sub.count())
+	}
+}
+
+func TestPublisherLeavesRetriesPastDeadlineToRelay(t *testing.T) {
+	sub := &subscriber{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(sub)
+	defer srv.Close()
+
+	p := NewPublisher(Config{
+		Subscribers: map[string][]string{"StockChanged": {srv.URL}},
+		MaxAttempts: 3,
+		BaseBackoff: time.Hour,
+	}, srv.Client(), &memoryLog{})
+
+	// ctx relay'я: срок аренды события
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	started := time.Now()
+	err := p.Publish(ctx, outbox.Event{ID: 1, EventType: "StockChanged", Payload: []byte(`{}`)})
+	if err == nil {
+		t.Fatal("Publish succeeded, want the 503")
+	}
+	if time.Since(started) > 500*time.Millisecond {
+		t.Errorf("Publish took %s, want it back before the deadline", time.Since(started))
+	}
+	if sub.count() != 1 {
+		t.Errorf("subscriber got %d requests, want 1", sub.count())
+	}
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Record stores a delivery attempt
+func (r *Repository) Record(ctx context.Context, d Delivery) error {
+
+	query := `
+		INSERT INTO webhook_deliveries
+			(event_id, event_type, url, attempt, status_code, error, succeeded, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		d.EventID,
+		d.EventType,
+		d.URL,
+		d.Attempt,
+		d.StatusCode,
+		d.Error,
+		d.Succeeded,
+		d.DurationMS,
+	)
+	return err
+}
+
+// Delivered reports whether the event was already delivered to url
+func (r *Repository) Delivered(ctx context.Context, eventID int64, url string) (bool, error) {
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM webhook_deliveries
+			WHERE event_id = $1
+			  AND url = $2
+			  AND succeeded
+		)
+	`
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, eventID, url).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,12 @@
+package product
+
+import "time"
+
+// Campaign groups products under one per-user limit: a user may hold at
+// most MaxPerUser units across all products of the campaign.
+type Campaign struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	MaxPerUser int       `json:"max_per_user"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,90 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (r *Repository) CreateCampaign(
+	ctx context.Context,
+	name string,
+	maxPerUser int,
+) (*Campaign, error) {
+
+	query := `
+		INSERT INTO campaigns (name, max_per_user)
+		VALUES ($1, $2)
+		RETURNING id, name, max_per_user, created_at
+	`
+
+	var c Campaign
+	err := r.db.QueryRowContext(ctx, query, name, maxPerUser).Scan(
+		&c.ID,
+		&c.Name,
+		&c.MaxPerUser,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (r *Repository) ListCampaigns(ctx context.Context) ([]Campaign, error) {
+
+	query := `
+		SELECT id, name, max_per_user, created_at
+		FROM campaigns
+		ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Campaign
+	for rows.Next() {
+		var c Campaign
+		if err := rows.Scan(
+			&c.ID,
+			&c.Name,
+			&c.MaxPerUser,
+			&c.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+
+	return result, rows.Err()
+}
+
+// GetCampaignTx reads a campaign inside a transaction
+func (r *Repository) GetCampaignTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+) (*Campaign, error) {
+
+	query := `
+		SELECT id, name, max_per_user, created_at
+		FROM campaigns
+		WHERE id = $1
+	`
+
+	var c Campaign
+	err := tx.QueryRowContext(ctx, query, id).Scan(
+		&c.ID,
+		&c.Name,
+		&c.MaxPerUser,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
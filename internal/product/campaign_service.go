@@ -0,0 +1,26 @@
+package product
+
+import (
+	"context"
+	"fmt"
+)
+
+func (s *Service) CreateCampaign(
+	ctx context.Context,
+	name string,
+	maxPerUser int,
+) (*Campaign, error) {
+
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	if maxPerUser <= 0 {
+		return nil, fmt.Errorf("%w: max_per_user must be > 0", ErrInvalidInput)
+	}
+
+	return s.repo.CreateCampaign(ctx, name, maxPerUser)
+}
+
+func (s *Service) ListCampaigns(ctx context.Context) ([]Campaign, error) {
+	return s.repo.ListCampaigns(ctx)
+}
@@ -1,10 +1,123 @@
 package product
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// Состояние распродажи товара относительно окна starts_at/ends_at
+const (
+	SaleUpcoming = "upcoming"
+	SaleLive     = "live"
+	SaleEnded    = "ended"
+)
+
+// Ошибки товаров; подробности добавляются через %w
+var (
+	// ErrOutOfStock — осталось меньше единиц, чем запрошено
+	ErrOutOfStock     = errors.New("product out of stock")
+	ErrSaleNotStarted = errors.New("sale has not started yet")
+	ErrSaleEnded      = errors.New("sale has ended")
+	ErrNotFound       = errors.New("product not found")
+	// ErrInvalidInput — запрос отклонён проверкой полей
+	ErrInvalidInput = errors.New("invalid input")
+)
 
 type Product struct {
 	ID        int64     `json:"id"`
 	Name      string    `json:"name"`
 	Stock     int       `json:"stock"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// HoldSeconds == nil — используется глобальная длительность резерва
+	HoldSeconds    *int `json:"hold_seconds,omitempty"`
+	MaxExtensions  int  `json:"max_extensions"`
+	MaxHoldSeconds *int `json:"max_hold_seconds,omitempty"`
+
+	// окно распродажи; nil — без ограничения с этой стороны
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+
+	// лимит единиц на пользователя (ACTIVE + CONFIRMED); nil — без лимита
+	MaxPerUser *int   `json:"max_per_user,omitempty"`
+	CampaignID *int64 `json:"campaign_id,omitempty"`
+
+	// Queued — резерв только через очередь (X-Queue-Token)
+	Queued bool `json:"queued"`
+}
+
+// SaleState reports whether the sale is upcoming, live or ended at now
+func (p *Product) SaleState(now time.Time) string {
+	switch {
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return SaleUpcoming
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return SaleEnded
+	default:
+		return SaleLive
+	}
+}
+
+// CheckSaleWindow returns ErrSaleNotStarted or ErrSaleEnded if reservations
+// are not accepted at now
+func (p *Product) CheckSaleWindow(now time.Time) error {
+	switch p.SaleState(now) {
+	case SaleUpcoming:
+		return ErrSaleNotStarted
+	case SaleEnded:
+		return ErrSaleEnded
+	default:
+		return nil
+	}
+}
+
+// HoldDuration returns the product hold, or def if the product has none
+func (p *Product) HoldDuration(def time.Duration) time.Duration {
+	if p.HoldSeconds == nil {
+		return def
+	}
+	return time.Duration(*p.HoldSeconds) * time.Second
+}
+
+// InitialHold is the hold of a new reservation: HoldDuration, but never
+// longer than MaxHold
+func (p *Product) InitialHold(def time.Duration) time.Duration {
+	hold := p.HoldDuration(def)
+	if maxHold := p.MaxHold(); maxHold > 0 && hold > maxHold {
+		return maxHold
+	}
+	return hold
+}
+
+// MaxHold returns the cap on total hold time including extensions; 0 — no cap
+func (p *Product) MaxHold() time.Duration {
+	if p.MaxHoldSeconds == nil {
+		return 0
+	}
+	return time.Duration(*p.MaxHoldSeconds) * time.Second
+}
+
+// CreateInput is everything a new product is created from
+type CreateInput struct {
+	Name           string `json:"name"`
+	Stock          int    `json:"stock"`
+	HoldSeconds    *int   `json:"hold_seconds"`
+	MaxExtensions  int    `json:"max_extensions"`
+	MaxHoldSeconds *int   `json:"max_hold_seconds"`
+
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+
+	MaxPerUser *int   `json:"max_per_user"`
+	CampaignID *int64 `json:"campaign_id"`
+
+	Queued bool `json:"queued"`
+}
+
+// StockLevel is the stock of a product right after a change.
+// Version grows by one with every change of that product's stock.
+type StockLevel struct {
+	ProductID int64 `json:"product_id"`
+	Stock     int   `json:"stock"`
+	Version   int64 `json:"version"`
 }
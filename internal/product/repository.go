@@ -4,6 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type Repository struct {
@@ -13,40 +18,126 @@ type Repository struct {
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
+
+const productColumns = `
+	id, name, stock, created_at,
+	hold_seconds, max_extensions, max_hold_seconds,
+	starts_at, ends_at,
+	max_per_user, campaign_id, queued
+`
+
 func (r *Repository) Create(
 	ctx context.Context,
-	name string,
-	stock int,
+	in CreateInput,
 ) (*Product, error) {
 	query := `
-		INSERT INTO products (name, stock)
-		VALUES ($1, $2)
-		RETURNING id, name, stock, created_at
-	`
+		INSERT INTO products (
+			name, stock, hold_seconds, max_extensions, max_hold_seconds,
+			starts_at, ends_at, max_per_user, campaign_id, queued
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING ` + productColumns
 
-	var p Product
-	err := r.db.QueryRowContext(
+	p, err := scanProduct(r.db.QueryRowContext(
 		ctx,
 		query,
-		name,
-		stock,
-	).Scan(
-		&p.ID,
-		&p.Name,
-		&p.Stock,
-		&p.CreatedAt,
-	)
+		in.Name,
+		in.Stock,
+		in.HoldSeconds,
+		in.MaxExtensions,
+		in.MaxHoldSeconds,
+		in.StartsAt,
+		in.EndsAt,
+		in.MaxPerUser,
+		in.CampaignID,
+		in.Queued,
+	))
+
+	// несуществующая кампания — ошибка запроса, а не БД
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.ConstraintName == "products_campaign_id_fkey" {
+		return nil, fmt.Errorf("%w: campaign %d not found", ErrInvalidInput, *in.CampaignID)
+	}
+
+	return p, err
+}
+
+func (r *Repository) GetByID(ctx context.Context, id int64) (*Product, error) {
+	query := `
+		SELECT ` + productColumns + `
+		FROM products
+		WHERE id = $1
+	`
+
+	return scanProduct(r.db.QueryRowContext(ctx, query, id))
+}
+
+// GetByIDTx reads a product inside a transaction
+func (r *Repository) GetByIDTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+) (*Product, error) {
+	query := `
+		SELECT ` + productColumns + `
+		FROM products
+		WHERE id = $1
+	`
+
+	return scanProduct(tx.QueryRowContext(ctx, query, id))
+}
+
+// GetByIDForUpdateTx reads and locks a product row, e.g. before several
+// stock changes that must see one consistent level
+func (r *Repository) GetByIDForUpdateTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+) (*Product, error) {
+	query := `
+		SELECT ` + productColumns + `
+		FROM products
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	return scanProduct(tx.QueryRowContext(ctx, query, id))
+}
 
+// GetStockLevels returns current stock of the given products
+func (r *Repository) GetStockLevels(ctx context.Context, ids []int64) ([]StockLevel, error) {
+	query := `
+		SELECT id, stock, stock_version
+		FROM products
+		WHERE id = ANY($1)
+		ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, ids)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &p, nil
+	var levels []StockLevel
+	for rows.Next() {
+		var level StockLevel
+		if err := rows.Scan(
+			&level.ProductID,
+			&level.Stock,
+			&level.Version,
+		); err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, rows.Err()
 }
 
 func (r *Repository) List(ctx context.Context) ([]Product, error) {
 	query := `
-		SELECT id, name, stock, created_at
+		SELECT ` + productColumns + `
 		FROM products
 		ORDER BY id
 	`
@@ -57,65 +148,171 @@ func (r *Repository) List(ctx context.Context) ([]Product, error) {
 	}
 	defer rows.Close()
 
+	return scanProducts(rows)
+}
+
+// ListBySale returns products whose sale is upcoming, live or ended at now.
+// A product without starts_at/ends_at is live all the time. The window is
+// stored in UTC, so now is compared in UTC too.
+func (r *Repository) ListBySale(
+	ctx context.Context,
+	sale string,
+	now time.Time,
+) ([]Product, error) {
+	query := `
+		SELECT ` + productColumns + `
+		FROM products
+		WHERE CASE $1::text
+			WHEN 'upcoming' THEN starts_at > $2
+			WHEN 'ended'    THEN ends_at <= $2
+			ELSE (starts_at IS NULL OR starts_at <= $2)
+			 AND (ends_at IS NULL OR ends_at > $2)
+		END
+		ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, sale, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanProducts(rows)
+}
+
+func scanProducts(rows *sql.Rows) ([]Product, error) {
 	var products []Product
 
 	for rows.Next() {
-		var p Product
-		if err := rows.Scan(
-			&p.ID,
-			&p.Name,
-			&p.Stock,
-			&p.CreatedAt,
-		); err != nil {
+		p, err := scanProduct(rows)
+		if err != nil {
 			return nil, err
 		}
-		products = append(products, p)
+		products = append(products, *p)
+	}
+
+	return products, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanProduct(row rowScanner) (*Product, error) {
+	var p Product
+	if err := row.Scan(
+		&p.ID,
+		&p.Name,
+		&p.Stock,
+		&p.CreatedAt,
+		&p.HoldSeconds,
+		&p.MaxExtensions,
+		&p.MaxHoldSeconds,
+		&p.StartsAt,
+		&p.EndsAt,
+		&p.MaxPerUser,
+		&p.CampaignID,
+		&p.Queued,
+	); err != nil {
+		return nil, err
 	}
 
-	return products, nil
+	return &p, nil
 }
 
+// DecreaseStockTx takes quantity units and returns the remaining stock.
+// Either all units are taken or none: with less stock left nothing changes.
 func (r *Repository) DecreaseStockTx(
 	ctx context.Context,
 	tx *sql.Tx,
 	productID int64,
-) error {
+	quantity int,
+) (StockLevel, error) {
 
 	query := `
 		UPDATE products
-		SET stock = stock - 1
-		WHERE id = $1 AND stock > 0
+		SET stock = stock - $2,
+		    stock_version = stock_version + 1
+		WHERE id = $1 AND stock >= $2
+		RETURNING id, stock, stock_version
 	`
 
-	res, err := tx.ExecContext(ctx, query, productID)
-	if err != nil {
-		return err
+	var level StockLevel
+	err := tx.QueryRowContext(ctx, query, productID, quantity).Scan(
+		&level.ProductID,
+		&level.Stock,
+		&level.Version,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return StockLevel{}, ErrOutOfStock
 	}
-
-	affected, err := res.RowsAffected()
 	if err != nil {
-		return err
+		return StockLevel{}, err
 	}
 
-	if affected == 0 {
-		return errors.New("product out of stock")
-	}
-
-	return nil
+	return level, nil
 }
 
+// IncreaseStockTx returns quantity units and returns the new stock
 func (r *Repository) IncreaseStockTx(
 	ctx context.Context,
 	tx *sql.Tx,
 	productID int64,
-) error {
+	quantity int,
+) (StockLevel, error) {
 
 	query := `
 		UPDATE products
-		SET stock = stock + 1
+		SET stock = stock + $2,
+		    stock_version = stock_version + 1
 		WHERE id = $1
+		RETURNING id, stock, stock_version
 	`
 
-	_, err := tx.ExecContext(ctx, query, productID)
-	return err
+	var level StockLevel
+	err := tx.QueryRowContext(ctx, query, productID, quantity).Scan(
+		&level.ProductID,
+		&level.Stock,
+		&level.Version,
+	)
+	return level, err
+}
+
+// IncreaseStockBatchTx returns stock for several products, one UPDATE per product,
+// and returns the new stock of each product.
+// Products are updated in id order so that concurrent sweepers never deadlock.
+func (r *Repository) IncreaseStockBatchTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	deltas map[int64]int,
+) (map[int64]StockLevel, error) {
+
+	ids := make([]int64, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	query := `
+		UPDATE products
+		SET stock = stock + $2,
+		    stock_version = stock_version + 1
+		WHERE id = $1
+		RETURNING id, stock, stock_version
+	`
+
+	levels := make(map[int64]StockLevel, len(ids))
+	for _, id := range ids {
+		var level StockLevel
+		if err := tx.QueryRowContext(ctx, query, id, deltas[id]).Scan(
+			&level.ProductID,
+			&level.Stock,
+			&level.Version,
+		); err != nil {
+			return nil, err
+		}
+		levels[id] = level
+	}
+
+	return levels, nil
 }
@@ -1,6 +1,12 @@
 package product
 
-import "context"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
 
 type Service struct {
 	repo *Repository
@@ -12,17 +18,62 @@ func NewService(repo *Repository) *Service {
 
 func (s *Service) Create(
 	ctx context.Context,
-	name string,
-	stock int,
+	in CreateInput,
 ) (*Product, error) {
 	// минимальная бизнес-проверка
-	if stock < 0 {
-		stock = 0
+	if in.Stock < 0 {
+		in.Stock = 0
 	}
 
-	return s.repo.Create(ctx, name, stock)
+	if in.HoldSeconds != nil && *in.HoldSeconds <= 0 {
+		return nil, fmt.Errorf("%w: hold_seconds must be > 0", ErrInvalidInput)
+	}
+	if in.MaxExtensions < 0 {
+		return nil, fmt.Errorf("%w: max_extensions must be >= 0", ErrInvalidInput)
+	}
+	if in.MaxHoldSeconds != nil && *in.MaxHoldSeconds <= 0 {
+		return nil, fmt.Errorf("%w: max_hold_seconds must be > 0", ErrInvalidInput)
+	}
+
+	// колонки TIMESTAMP без зоны: храним UTC, иначе "+03:00" сохранится
+	// как время на часах в Москве
+	in.StartsAt = utc(in.StartsAt)
+	in.EndsAt = utc(in.EndsAt)
+
+	if in.StartsAt != nil && in.EndsAt != nil && !in.EndsAt.After(*in.StartsAt) {
+		return nil, fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidInput)
+	}
+	if in.MaxPerUser != nil && *in.MaxPerUser <= 0 {
+		return nil, fmt.Errorf("%w: max_per_user must be > 0", ErrInvalidInput)
+	}
+
+	return s.repo.Create(ctx, in)
 }
 
-func (s *Service) List(ctx context.Context) ([]Product, error) {
-	return s.repo.List(ctx)
+func (s *Service) GetByID(ctx context.Context, id int64) (*Product, error) {
+	p, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return p, err
+}
+
+// List returns all products, or only those in the given sale state
+func (s *Service) List(ctx context.Context, sale string) ([]Product, error) {
+	switch sale {
+	case "":
+		return s.repo.List(ctx)
+	case SaleUpcoming, SaleLive, SaleEnded:
+		return s.repo.ListBySale(ctx, sale, time.Now())
+	default:
+		return nil, fmt.Errorf("%w: sale must be upcoming, live or ended", ErrInvalidInput)
+	}
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
 }
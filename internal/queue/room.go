@@ -0,0 +1,371 @@
+// Package queue is a Redis-backed waiting room for hot products.
+//
+// A client joins the queue of a product and gets a token with a ticket
+// number. Tickets are admitted in order at a fixed rate per product; an
+// admitted token may be used for one reservation within the admission
+// window. Admission is advanced lazily by a Lua script on every status
+// check, using the time of the last admission stored in Redis, so any
+// number of instances can serve the queue without a coordinator. Each
+// admission is logged with the time it happened, so a ticket's admission
+// window starts when it is admitted, not when its holder first looks.
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "queue:"
+
+var (
+	ErrTokenRequired = errors.New("product is queued: X-Queue-Token is required")
+	ErrTokenInvalid  = errors.New("queue token is invalid for this product and user")
+	ErrNotAdmitted   = errors.New("queue token is not admitted yet")
+	ErrTokenExpired  = errors.New("queue token admission window has passed")
+	ErrTokenUsed     = errors.New("queue token is already used")
+)
+
+// joinScript gives the user a ticket once per product: a repeated join
+// returns the token issued before.
+//
+// KEYS: user key, seq key, token key; ARGV: token, ttl ms, product id, user id
+var joinScript = redis.NewScript(`
+local existing = redis.call('GET', KEYS[1])
+if existing then
+	return existing
+end
+local ticket = redis.call('INCR', KEYS[2])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+redis.call('HSET', KEYS[3], 'product_id', ARGV[3], 'user_id', ARGV[4], 'ticket', ticket)
+redis.call('PEXPIRE', KEYS[3], ARGV[2])
+return ARGV[1]
+`)
+
+// advanceScript admits tickets accrued since the last admission at ARGV[2]
+// per second and returns the last admitted ticket. Capacity is not banked
+// while the queue is empty.
+//
+// Every admission step is logged in a sorted set: score is the last ticket
+// of the step, member "ticket:ms" with the time that ticket got its turn.
+// A ticket's admission time is the one of the first step at or above it.
+// Only as many steps as can be admitted within the token TTL are kept.
+//
+// KEYS: seq key, admitted key, last admission key, admissions key
+// ARGV: now ms, rate, steps to keep, token ttl ms
+var advanceScript = redis.NewScript(`
+local seq = tonumber(redis.call('GET', KEYS[1]) or '0')
+local admitted = tonumber(redis.call('GET', KEYS[2]) or '0')
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local last = tonumber(redis.call('GET', KEYS[3]) or '-1')
+if admitted >= seq or last < 0 then
+	redis.call('SET', KEYS[3], now)
+	return admitted
+end
+local n = math.floor((now - last) * rate / 1000)
+if n <= 0 then
+	return admitted
+end
+local from = admitted
+admitted = math.min(seq, admitted + n)
+local at = last + math.floor((admitted - from) * 1000 / rate)
+redis.call('SET', KEYS[2], admitted)
+if admitted >= seq then
+	redis.call('SET', KEYS[3], now)
+else
+	redis.call('SET', KEYS[3], at)
+end
+redis.call('ZADD', KEYS[4], admitted, string.format('%d:%d', admitted, at))
+redis.call('ZREMRANGEBYRANK', KEYS[4], 0, -tonumber(ARGV[3]) - 1)
+redis.call('PEXPIRE', KEYS[4], ARGV[4])
+return admitted
+`)
+
+// claimScript marks the token used if it belongs to the product and user
+// and isn't used yet: of concurrent requests with one token only one
+// gets it.
+//
+// KEYS: token key; ARGV: product id, user id
+// Returns: 1 claimed, 0 another product or user, -1 already used
+var claimScript = redis.NewScript(`
+local t = redis.call('HMGET', KEYS[1], 'product_id', 'user_id', 'used')
+if t[1] ~= ARGV[1] or t[2] ~= ARGV[2] then
+	return 0
+end
+if t[3] then
+	return -1
+end
+redis.call('HSET', KEYS[1], 'used', 1)
+return 1
+`)
+
+// consumeScript deletes the token only if it belongs to the product and user
+//
+// KEYS: token key, user key; ARGV: product id, user id
+var consumeScript = redis.NewScript(`
+local owner = redis.call('HMGET', KEYS[1], 'product_id', 'user_id')
+if owner[1] ~= ARGV[1] or owner[2] ~= ARGV[2] then
+	return 0
+end
+return redis.call('DEL', KEYS[1], KEYS[2])
+`)
+
+type Config struct {
+	// AdmitRate — сколько билетов в секунду пропускается на товар
+	AdmitRate int
+	// AdmissionWindow — сколько действует пропущенный токен
+	AdmissionWindow time.Duration
+	// TokenTTL — сколько живёт токен, включая ожидание в очереди
+	TokenTTL time.Duration
+}
+
+// Ticket is the state of a token in the queue. Position is the number of
+// tickets admitted before this one is, 0 once admitted.
+type Ticket struct {
+	Token      string     `json:"token"`
+	ProductID  int64      `json:"product_id"`
+	UserID     int64      `json:"user_id"`
+	Number     int64      `json:"ticket"`
+	Position   int64      `json:"position"`
+	Admitted   bool       `json:"admitted"`
+	ETASeconds float64    `json:"eta_seconds"`
+	AdmittedAt *time.Time `json:"admitted_at,omitempty"`
+	// ValidUntil — до какого момента токеном можно создать резерв
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+type Room struct {
+	redis *redis.Client
+	cfg   Config
+}
+
+func NewRoom(redis *redis.Client, cfg Config) *Room {
+	if cfg.AdmitRate <= 0 {
+		cfg.AdmitRate = 1
+	}
+	return &Room{
+		redis: redis,
+		cfg:   cfg,
+	}
+}
+
+// Join puts the user in the product queue, or returns their current ticket
+func (r *Room) Join(ctx context.Context, productID, userID int64) (*Ticket, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err = joinScript.Run(
+		ctx,
+		r.redis,
+		[]string{userKey(productID, userID), seqKey(productID), tokenKey(token)},
+		token,
+		r.cfg.TokenTTL.Milliseconds(),
+		productID,
+		userID,
+	).Text()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Status(ctx, token)
+}
+
+// Status returns position and ETA of a token and, once admitted, when its
+// admission window started and ends
+func (r *Room) Status(ctx context.Context, token string) (*Ticket, error) {
+	fields, err := r.redis.HGetAll(ctx, tokenKey(token)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrTokenInvalid
+	}
+
+	t := Ticket{Token: token}
+	t.ProductID, _ = strconv.ParseInt(fields["product_id"], 10, 64)
+	t.UserID, _ = strconv.ParseInt(fields["user_id"], 10, 64)
+	t.Number, _ = strconv.ParseInt(fields["ticket"], 10, 64)
+
+	now := time.Now()
+	admitted, err := advanceScript.Run(
+		ctx,
+		r.redis,
+		[]string{seqKey(t.ProductID), admittedKey(t.ProductID), lastAdmitKey(t.ProductID), admissionsKey(t.ProductID)},
+		now.UnixMilli(),
+		r.cfg.AdmitRate,
+		r.admissionsToKeep(),
+		r.cfg.TokenTTL.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Number > admitted {
+		t.Position = t.Number - admitted
+		t.ETASeconds = float64(t.Position) / float64(r.cfg.AdmitRate)
+		return &t, nil
+	}
+
+	ms, err := r.admittedAt(ctx, token, fields, t.ProductID, t.Number, now)
+	if err != nil {
+		return nil, err
+	}
+
+	admittedAt := time.UnixMilli(ms)
+	validUntil := admittedAt.Add(r.cfg.AdmissionWindow)
+
+	t.Admitted = true
+	t.AdmittedAt = &admittedAt
+	t.ValidUntil = &validUntil
+
+	return &t, nil
+}
+
+// admittedAt returns when ticket got its turn, from the admission log, and
+// keeps it on the token so the log may be trimmed
+func (r *Room) admittedAt(ctx context.Context, token string, fields map[string]string, productID, ticket int64, now time.Time) (int64, error) {
+	if ms, err := strconv.ParseInt(fields["admitted_at"], 10, 64); err == nil {
+		return ms, nil
+	}
+
+	steps, err := r.redis.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     admissionsKey(productID),
+		Start:   strconv.FormatInt(ticket, 10),
+		Stop:    "+inf",
+		ByScore: true,
+		Count:   1,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// шага нет, только если билет пропущен до журнала пропусков —
+	// тогда окно идёт с этой проверки, как раньше
+	at := now.UnixMilli()
+	if len(steps) > 0 {
+		_, ms, _ := strings.Cut(steps[0], ":")
+		if v, err := strconv.ParseInt(ms, 10, 64); err == nil {
+			at = v
+		}
+	}
+
+	if err := r.redis.HSetNX(ctx, tokenKey(token), "admitted_at", at).Err(); err != nil {
+		return 0, err
+	}
+	return r.redis.HGet(ctx, tokenKey(token), "admitted_at").Int64()
+}
+
+// admissionsToKeep is how many admission steps fit into the token TTL:
+// each step admits at least one ticket
+func (r *Room) admissionsToKeep() int64 {
+	return int64(r.cfg.AdmitRate)*int64(r.cfg.TokenTTL/time.Second) + 1
+}
+
+// Check lets a reservation of productID by userID through only with an
+// admitted token whose admission window is still open
+func (r *Room) Check(ctx context.Context, token string, productID, userID int64) error {
+	if token == "" {
+		return ErrTokenRequired
+	}
+
+	t, err := r.Status(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	if t.ProductID != productID || t.UserID != userID {
+		return ErrTokenInvalid
+	}
+	if !t.Admitted {
+		return fmt.Errorf("%w: position %d, eta %.0fs", ErrNotAdmitted, t.Position, t.ETASeconds)
+	}
+	if time.Now().After(*t.ValidUntil) {
+		return ErrTokenExpired
+	}
+
+	return nil
+}
+
+// Claim checks the token like Check and marks it used, atomically: of
+// concurrent reservations with one token only one gets through, the rest
+// get ErrTokenUsed. Call Unclaim if the reservation then isn't created and
+// Consume once it is.
+func (r *Room) Claim(ctx context.Context, token string, productID, userID int64) error {
+	if err := r.Check(ctx, token, productID, userID); err != nil {
+		return err
+	}
+
+	claimed, err := claimScript.Run(ctx, r.redis, []string{tokenKey(token)}, productID, userID).Int64()
+	if err != nil {
+		return err
+	}
+
+	switch claimed {
+	case 1:
+		return nil
+	case -1:
+		return ErrTokenUsed
+	default:
+		return ErrTokenInvalid
+	}
+}
+
+// Unclaim makes a claimed token usable again
+func (r *Room) Unclaim(ctx context.Context, token string) error {
+	return r.redis.HDel(ctx, tokenKey(token), "used").Err()
+}
+
+// Consume invalidates a token once its reservation is created; the user
+// has to queue again for another one. A token of another product or user
+// is left alone.
+func (r *Room) Consume(ctx context.Context, token string, productID, userID int64) error {
+	return consumeScript.Run(
+		ctx,
+		r.redis,
+		[]string{tokenKey(token), userKey(productID, userID)},
+		productID,
+		userID,
+	).Err()
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func seqKey(productID int64) string {
+	return fmt.Sprintf("%s%d:seq", keyPrefix, productID)
+}
+
+func admittedKey(productID int64) string {
+	return fmt.Sprintf("%s%d:admitted", keyPrefix, productID)
+}
+
+func lastAdmitKey(productID int64) string {
+	return fmt.Sprintf("%s%d:last_admit", keyPrefix, productID)
+}
+
+func admissionsKey(productID int64) string {
+	return fmt.Sprintf("%s%d:admissions", keyPrefix, productID)
+}
+
+func userKey(productID, userID int64) string {
+	return fmt.Sprintf("%s%d:user:%d", keyPrefix, productID, userID)
+}
+
+func tokenKey(token string) string {
+	return keyPrefix + "token:" + token
+}
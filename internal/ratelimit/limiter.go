@@ -0,0 +1,114 @@
+// Package ratelimit throttles clients with GCRA (generic cell rate
+// algorithm).
+//
+// A limit of Rate requests per Period lets a client send up to Burst
+// requests at once and then one every Period/Rate. GCRA keeps a single
+// number per key — the theoretical arrival time (TAT) of the next request
+// — so the Redis limiter is one key and one script call per check, shared
+// by all instances. If Redis fails, Fallback switches to an in-process
+// limiter with the same algorithm, which then counts per instance.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	// сколько запросов можно сразу; 0 — Rate
+	Burst int
+}
+
+// Enabled reports whether l limits anything; the zero Limit does not
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Period > 0
+}
+
+// Capacity is how many requests may be sent at once
+func (l Limit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// interval is the time one request "costs"
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Rate, l.Period)
+}
+
+// ParseLimit reads "rate/period", e.g. "10/1s" or "100/1m"; "" and "0"
+// give the zero Limit, which disables limiting
+func ParseLimit(s string) (Limit, error) {
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+
+	rate, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q: want rate/period, e.g. 10/1s", s)
+	}
+
+	n, err := strconv.Atoi(rate)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: rate must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: period must be a positive duration", s)
+	}
+	if d/time.Duration(n) < time.Millisecond {
+		return Limit{}, fmt.Errorf("rate limit %q: more than one request per millisecond", s)
+	}
+
+	return Limit{Rate: n, Period: d}, nil
+}
+
+// Result of one check. Limit and Remaining count requests of the burst;
+// ResetAfter is when the whole burst is available again.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow takes one request from key's budget under l
+	Allow(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+// gcra is the decision for a request arriving at now when the stored TAT
+// is tat; it returns the result and the TAT to store if allowed. The Lua
+// script in redis.go does the same in microseconds.
+func gcra(now, tat time.Time, l Limit) (Result, time.Time) {
+	interval := l.interval()
+	tolerance := interval * time.Duration(l.Capacity())
+
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+
+	res := Result{Limit: l.Capacity()}
+	if wait := next.Sub(now) - tolerance; wait > 0 {
+		res.RetryAfter = wait
+		res.ResetAfter = tat.Sub(now)
+		return res, tat
+	}
+
+	res.Allowed = true
+	res.Remaining = int((tolerance - next.Sub(now)) / interval)
+	res.ResetAfter = next.Sub(now)
+	return res, next
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGCRA(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tenPer10s := Limit{Rate: 10, Period: 10 * time.Second}
+
+	type step struct {
+		at    time.Duration // от now
+		want  Result
+		wantT time.Duration // TAT после шага, от now
+	}
+
+	tests := []struct {
+		name  string
+		limit Limit
+		tat   time.Time
+		steps []step
+	}{
+		{
+			name:  "new key",
+			limit: tenPer10s,
+			steps: []step{
+				{0, Result{Allowed: true, Limit: 10, Remaining: 9, ResetAfter: time.Second}, time.Second},
+			},
+		},
+		{
+			name:  "stale tat counts from now",
+			limit: tenPer10s,
+			tat:   now.Add(-time.Hour),
+			steps: []step{
+				{0, Result{Allowed: true, Limit: 10, Remaining: 9, ResetAfter: time.Second}, time.Second},
+			},
+		},
+		{
+			name:  "half spent",
+			limit: tenPer10s,
+			tat:   now.Add(5 * time.Second),
+			steps: []step{
+				{0, Result{Allowed: true, Limit: 10, Remaining: 4, ResetAfter: 6 * time.Second}, 6 * time.Second},
+			},
+		},
+		{
+			name:  "burst then denied",
+			limit: tenPer10s,
+			tat:   now.Add(9 * time.Second),
+			steps: []step{
+				{0, Result{Allowed: true, Limit: 10, Remaining: 0, ResetAfter: 10 * time.Second}, 10 * time.Second},
+				{0, Result{Allowed: false, Limit: 10, RetryAfter: time.Second, ResetAfter: 10 * time.Second}, 10 * time.Second},
+				{400 * time.Millisecond, Result{Allowed: false, Limit: 10, RetryAfter: 600 * time.Millisecond, ResetAfter: 9600 * time.Millisecond}, 10 * time.Second},
+				// через interval освобождается ровно один запрос
+				{time.Second, Result{Allowed: true, Limit: 10, Remaining: 0, ResetAfter: 10 * time.Second}, 11 * time.Second},
+			},
+		},
+		{
+			name:  "explicit burst",
+			limit: Limit{Rate: 1, Period: time.Second, Burst: 3},
+			steps: []step{
+				{0, Result{Allowed: true, Limit: 3, Remaining: 2, ResetAfter: time.Second}, time.Second},
+				{0, Result{Allowed: true, Limit: 3, Remaining: 1, ResetAfter: 2 * time.Second}, 2 * time.Second},
+				{0, Result{Allowed: true, Limit: 3, Remaining: 0, ResetAfter: 3 * time.Second}, 3 * time.Second},
+				{0, Result{Allowed: false, Limit: 3, RetryAfter: time.Second, ResetAfter: 3 * time.Second}, 3 * time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tat := tt.tat
+			for i, s := range tt.steps {
+				at := now.Add(s.at)
+				res, next := gcra(at, tat, tt.limit)
+				if res != s.want {
+					t.Fatalf("step %d: got %+v, want %+v", i, res, s.want)
+				}
+				if want := now.Add(s.wantT); !next.Equal(want) {
+					t.Fatalf("step %d: tat %s, want %s", i, next.Sub(now), s.wantT)
+				}
+				tat = next
+			}
+		})
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"", Limit{}, false},
+		{"0", Limit{}, false},
+		{"10/1s", Limit{Rate: 10, Period: time.Second}, false},
+		{"600/1m", Limit{Rate: 600, Period: time.Minute}, false},
+		{"10", Limit{}, true},
+		{"-1/1s", Limit{}, true},
+		{"10/0s", Limit{}, true},
+		{"2000/1s", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q): err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sweepInterval — как часто LocalLimiter выбрасывает восстановившиеся ключи
+const sweepInterval = time.Minute
+
+// LocalLimiter keeps the budgets in process memory. Each instance counts
+// on its own, so N instances let through up to N times the limit.
+type LocalLimiter struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{tats: make(map[string]time.Time)}
+}
+
+func (l *LocalLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	res, tat := gcra(now, l.tats[key], limit)
+	if res.Allowed {
+		l.tats[key] = tat
+	}
+
+	// ключ с TAT в прошлом равен отсутствующему
+	if now.Sub(l.lastSweep) > sweepInterval {
+		for k, t := range l.tats {
+			if t.Before(now) {
+				delete(l.tats, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	return res, nil
+}
+
+// Fallback uses primary and, when it fails, secondary. After a failure
+// primary is skipped for retryAfter so requests don't each wait for a
+// Redis timeout.
+type Fallback struct {
+	primary    Limiter
+	secondary  Limiter
+	retryAfter time.Duration
+	// unix nano, до которого primary не используется
+	downUntil atomic.Int64
+}
+
+func NewFallback(primary, secondary Limiter, retryAfter time.Duration) *Fallback {
+	return &Fallback{primary: primary, secondary: secondary, retryAfter: retryAfter}
+}
+
+func (f *Fallback) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	if now.UnixNano() >= f.downUntil.Load() {
+		res, err := f.primary.Allow(ctx, key, limit)
+		if err == nil {
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return Result{}, err
+		}
+
+		if f.downUntil.Swap(now.Add(f.retryAfter).UnixNano()) <= now.UnixNano() {
+			log.Printf("ratelimit: primary limiter failed, using in-process limits for %s: %v", f.retryAfter, err)
+		}
+	}
+
+	return f.secondary.Allow(ctx, key, limit)
+}
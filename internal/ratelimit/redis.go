@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "ratelimit:"
+
+// gcraScript is gcra() on Redis time, in microseconds. The TAT is written
+// with %d: Lua would print a number this large in exponent form.
+//
+// KEYS: TAT key; ARGV: interval µs, tolerance µs
+// Returns: allowed (0/1), remaining, retry after µs, reset after µs
+var gcraScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local tat = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tat < now then
+	tat = now
+end
+local nxt = tat + interval
+local wait = nxt - now - tolerance
+if wait > 0 then
+	return {0, 0, wait, tat - now}
+end
+redis.call('SET', KEYS[1], string.format('%d', nxt), 'PX', math.ceil((nxt - now) / 1000))
+return {1, math.floor((tolerance - (nxt - now)) / interval), 0, nxt - now}
+`)
+
+// RedisLimiter keeps the budgets in Redis, shared by all instances
+type RedisLimiter struct {
+	rdb *redis.Client
+}
+
+func NewRedisLimiter(rdb *redis.Client) *RedisLimiter {
+	return &RedisLimiter{rdb: rdb}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	interval := limit.interval()
+	tolerance := interval * time.Duration(limit.Capacity())
+
+	v, err := gcraScript.Run(ctx, l.rdb, []string{keyPrefix + key},
+		interval.Microseconds(), tolerance.Microseconds(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    v[0] == 1,
+		Limit:      limit.Capacity(),
+		Remaining:  int(v[1]),
+		RetryAfter: time.Duration(v[2]) * time.Microsecond,
+		ResetAfter: time.Duration(v[3]) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,50 @@
+package reconcile
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job runs the reconciler periodically inside the app
+type Job struct {
+	reconciler *Reconciler
+	interval   time.Duration
+	opts       Options
+}
+
+func NewJob(reconciler *Reconciler, interval time.Duration, opts Options) *Job {
+	return &Job{
+		reconciler: reconciler,
+		interval:   interval,
+		opts:       opts,
+	}
+}
+
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	log.Printf("reconcile job started, interval=%s repair=%t", j.interval, j.opts.Repair)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("reconcile job stopped")
+			return
+		case <-ticker.C:
+			report, err := j.reconciler.Run(ctx, j.opts)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("reconcile failed: %v", err)
+				}
+				continue
+			}
+
+			log.Printf("reconcile done: checked=%d discrepancies=%d", report.Checked, len(report.Discrepancies))
+			for _, d := range report.Discrepancies {
+				log.Printf("reconcile: %s %s expected=%q actual=%q repaired=%t", d.Kind, d.Key, d.Expected, d.Actual, d.Repaired)
+			}
+		}
+	}
+}
@@ -0,0 +1,363 @@
+// Package reconcile compares what the service keeps in Redis with the
+// PostgreSQL tables it mirrors, reports discrepancies and optionally
+// repairs Redis. PostgreSQL is always treated as the truth.
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash-sale-reservation/internal/inventory"
+	"flash-sale-reservation/internal/metrics"
+	"flash-sale-reservation/internal/product"
+	"flash-sale-reservation/internal/reservation"
+)
+
+// Виды расхождений
+const (
+	KindMissingReservationKey = "missing_reservation_key"
+	KindStaleReservationKey   = "stale_reservation_key"
+	KindReservationTTL        = "reservation_ttl_mismatch"
+	KindStockCounter          = "stock_counter_mismatch"
+	KindMissingStockCounter   = "missing_stock_counter"
+	KindMetric                = "metric_mismatch"
+)
+
+// ttlTolerance — допустимое расхождение TTL ключа и expires_at
+const ttlTolerance = 5 * time.Second
+
+const scanCount = 1000
+
+type Options struct {
+	// Repair = false — dry-run: только отчёт
+	Repair bool
+	// CheckInventory сверяет счётчики inventory gate
+	CheckInventory bool
+}
+
+type Discrepancy struct {
+	Kind     string `json:"kind"`
+	Key      string `json:"key"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Repaired bool   `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	StartedAt     time.Time     `json:"started_at"`
+	DryRun        bool          `json:"dry_run"`
+	Checked       int           `json:"checked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+type Reconciler struct {
+	redis           *redis.Client
+	reservationRepo *reservation.Repository
+	productRepo     *product.Repository
+	gate            *inventory.Gate
+}
+
+func NewReconciler(
+	redis *redis.Client,
+	reservationRepo *reservation.Repository,
+	productRepo *product.Repository,
+	gate *inventory.Gate,
+) *Reconciler {
+	return &Reconciler{
+		redis:           redis,
+		reservationRepo: reservationRepo,
+		productRepo:     productRepo,
+		gate:            gate,
+	}
+}
+
+func (r *Reconciler) Run(ctx context.Context, opts Options) (*Report, error) {
+	report := &Report{
+		StartedAt: time.Now(),
+		DryRun:    !opts.Repair,
+	}
+
+	if err := r.checkReservationKeys(ctx, opts, report); err != nil {
+		return nil, fmt.Errorf("reservation keys: %w", err)
+	}
+
+	if opts.CheckInventory {
+		if err := r.checkStockCounters(ctx, opts, report); err != nil {
+			return nil, fmt.Errorf("stock counters: %w", err)
+		}
+	}
+
+	if err := r.checkMetrics(ctx, opts, report); err != nil {
+		return nil, fmt.Errorf("metrics: %w", err)
+	}
+
+	return report, nil
+}
+
+// checkReservationKeys: у каждого живого ACTIVE резерва есть reservation:{id}
+// с TTL до expires_at (у строки корзины — общий cart:{id}), а у закрытых
+// резервов и корзин ключа нет.
+func (r *Reconciler) checkReservationKeys(ctx context.Context, opts Options, report *Report) error {
+	active, err := r.reservationRepo.ListActive(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	// 1. ключи без ACTIVE резерва или корзины
+	if err := r.checkStaleKeys(ctx, opts, report, reservation.TTLKeyPrefix, "reservation", r.reservationRepo.GetStatuses); err != nil {
+		return err
+	}
+	if err := r.checkStaleKeys(ctx, opts, report, reservation.CartTTLKeyPrefix, "cart", r.reservationRepo.GetCartStatuses); err != nil {
+		return err
+	}
+
+	// 2. ACTIVE резервы без ключа или с неверным TTL
+	seenCarts := make(map[int64]bool)
+	for _, res := range active {
+		// истёкшие резервы — забота sweeper'а, ключ у них уже истёк
+		if !res.ExpiresAt.After(now) {
+			continue
+		}
+
+		key := reservation.TTLKey(res.ID)
+		if res.CartID != nil {
+			// строки корзины делят один ключ и один срок
+			if seenCarts[*res.CartID] {
+				continue
+			}
+			seenCarts[*res.CartID] = true
+			key = reservation.CartTTLKey(*res.CartID)
+		}
+		report.Checked++
+
+		want := time.Until(res.ExpiresAt)
+
+		// PTTL: -2 — ключа нет, -1 — ключ без TTL
+		ttl, err := r.redis.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+
+		d := Discrepancy{
+			Key:      key,
+			Expected: "ttl " + want.Round(time.Second).String(),
+		}
+
+		switch {
+		case ttl == -2:
+			d.Kind = KindMissingReservationKey
+			d.Actual = "no key"
+			if opts.Repair {
+				d.setResult(r.redis.Set(ctx, key, "active", want).Err())
+			}
+		case ttl == -1 || (ttl-want).Abs() > ttlTolerance:
+			d.Kind = KindReservationTTL
+			d.Actual = "ttl " + ttl.Round(time.Second).String()
+			if ttl == -1 {
+				d.Actual = "no ttl"
+			}
+			if opts.Repair {
+				d.setResult(r.redis.PExpireAt(ctx, key, res.ExpiresAt).Err())
+			}
+		default:
+			continue
+		}
+
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+
+	return nil
+}
+
+// checkStaleKeys reports keys prefix{id} whose reservation or cart (what)
+// is no longer ACTIVE; statuses looks the ids up in PostgreSQL.
+func (r *Reconciler) checkStaleKeys(
+	ctx context.Context,
+	opts Options,
+	report *Report,
+	prefix string,
+	what string,
+	statuses func(context.Context, []int64) (map[int64]string, error),
+) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.redis.Scan(ctx, cursor, prefix+"*", scanCount).Result()
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		idByKey := make(map[string]int64, len(keys))
+		for _, key := range keys {
+			id, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 64)
+			if err != nil {
+				continue
+			}
+			ids = append(ids, id)
+			idByKey[key] = id
+		}
+
+		found, err := statuses(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			id, ok := idByKey[key]
+			if !ok {
+				continue
+			}
+			report.Checked++
+
+			status, ok := found[id]
+			if ok && status == reservation.StatusActive {
+				continue
+			}
+			if !ok {
+				status = "not found"
+			}
+
+			d := Discrepancy{
+				Kind:     KindStaleReservationKey,
+				Key:      key,
+				Expected: "no key (" + what + " " + status + ")",
+				Actual:   "key exists",
+			}
+			if opts.Repair {
+				d.setResult(r.redis.Del(ctx, key).Err())
+			}
+			report.Discrepancies = append(report.Discrepancies, d)
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// checkStockCounters сверяет inventory:stock:{id} с products.stock.
+// Идущие в этот момент резервы дают кратковременный дрейф, поэтому
+// счётчик читается дважды и товар пропускается, если он изменился.
+func (r *Reconciler) checkStockCounters(ctx context.Context, opts Options, report *Report) error {
+	products, err := r.productRepo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		key := inventory.Key(p.ID)
+
+		before, err := r.redis.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		levels, err := r.productRepo.GetStockLevels(ctx, []int64{p.ID})
+		if err != nil {
+			return err
+		}
+		if len(levels) == 0 {
+			continue
+		}
+		stock := levels[0].Stock
+
+		after, err := r.redis.Get(ctx, key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if before != after {
+			continue
+		}
+		report.Checked++
+
+		expected := strconv.Itoa(stock)
+		if after == expected {
+			continue
+		}
+
+		d := Discrepancy{
+			Kind:     KindStockCounter,
+			Key:      key,
+			Expected: expected,
+			Actual:   after,
+		}
+		if after == "" {
+			d.Kind = KindMissingStockCounter
+			d.Actual = "no key"
+		}
+		if opts.Repair {
+			d.setResult(r.gate.Set(ctx, p.ID, stock))
+		}
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+
+	return nil
+}
+
+// checkMetrics сверяет счётчики metrics:reservations:* с таблицей reservations
+func (r *Reconciler) checkMetrics(ctx context.Context, opts Options, report *Report) error {
+	counts, err := r.reservationRepo.CountByStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+
+	expected := map[string]int64{
+		metrics.ReservationsCreated:   total,
+		metrics.ReservationsConfirmed: counts[reservation.StatusConfirmed],
+		metrics.ReservationsCanceled:  counts[reservation.StatusCanceled],
+		metrics.ReservationsExpired:   counts[reservation.StatusExpired],
+	}
+
+	for _, key := range []string{
+		metrics.ReservationsCreated,
+		metrics.ReservationsConfirmed,
+		metrics.ReservationsCanceled,
+		metrics.ReservationsExpired,
+	} {
+		report.Checked++
+
+		actual, err := r.redis.Get(ctx, key).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		if actual == expected[key] {
+			continue
+		}
+
+		d := Discrepancy{
+			Kind:     KindMetric,
+			Key:      key,
+			Expected: strconv.FormatInt(expected[key], 10),
+			Actual:   strconv.FormatInt(actual, 10),
+		}
+		if opts.Repair {
+			d.setResult(r.redis.Set(ctx, key, expected[key], 0).Err())
+		}
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+
+	return nil
+}
+
+func (d *Discrepancy) setResult(err error) {
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+	d.Repaired = true
+}
@@ -0,0 +1,65 @@
+package reservation
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Причины отмены резерва
+const (
+	CancelUserChangedMind = "user_changed_mind"
+	CancelPaymentFailed   = "payment_failed"
+	CancelFraud           = "fraud"
+	CancelAdminOverride   = "admin_override"
+	CancelSaleEnded       = "sale_ended"
+)
+
+// cancelReasons lists the reasons each actor may give, default first
+var cancelReasons = map[string][]string{
+	ActorUser:   {CancelUserChangedMind, CancelPaymentFailed},
+	ActorAdmin:  {CancelAdminOverride, CancelFraud, CancelPaymentFailed, CancelUserChangedMind},
+	ActorSystem: {CancelSaleEnded},
+}
+
+// Cancellation is who cancels a reservation and why
+type Cancellation struct {
+	Actor string
+	// UserID — кто отменяет свой резерв, только для ActorUser
+	UserID int64
+	// Reason — пусто: причина по умолчанию для Actor
+	Reason string
+}
+
+// normalize fills in the default reason and rejects a reason the actor
+// may not give
+func (c *Cancellation) normalize() error {
+	reasons, ok := cancelReasons[c.Actor]
+	if !ok {
+		return fmt.Errorf("%w: unknown actor %q", ErrInvalidInput, c.Actor)
+	}
+	if c.Actor == ActorUser && c.UserID <= 0 {
+		return fmt.Errorf("%w: user_id must be > 0", ErrInvalidInput)
+	}
+
+	if c.Reason == "" {
+		c.Reason = reasons[0]
+	}
+	if !slices.Contains(reasons, c.Reason) {
+		return fmt.Errorf("%w: %s can't cancel with reason %q", ErrInvalidInput, c.Actor, c.Reason)
+	}
+
+	return nil
+}
+
+// checkOwner lets a user cancel only what they reserved; admin and system
+// may cancel anything
+func (c Cancellation) checkOwner(userID int64) error {
+	if c.Actor != ActorUser {
+		return nil
+	}
+	return checkOwnedBy(userID, c.UserID)
+}
+
+func (c Cancellation) statusChange() StatusChange {
+	return StatusChange{Actor: c.Actor, Reason: c.Reason}
+}
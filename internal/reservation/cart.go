@@ -0,0 +1,42 @@
+package reservation
+
+import "time"
+
+// MaxCartLines caps the number of distinct products in one cart
+const MaxCartLines = 20
+
+// Cart is a set of reservations (lines) held all-or-nothing with one
+// shared expiry; the lines expire together. Status is derived from the
+// lines, see cartStatus.
+type Cart struct {
+	ID        int64         `json:"id"`
+	UserID    int64         `json:"user_id"`
+	Status    string        `json:"status"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	CreatedAt time.Time     `json:"created_at"`
+	Lines     []Reservation `json:"lines"`
+}
+
+type CartItem struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int   `json:"quantity"`
+}
+
+// cartStatusOrder ranks line statuses for cartStatus. Lines expire as a
+// unit, so an EXPIRED line means the cart ran out after whatever closed
+// the other lines (e.g. a sale that ended for one of the products).
+var cartStatusOrder = []string{StatusActive, StatusConfirmed, StatusExpired, StatusCanceled}
+
+// cartStatus is the first status of cartStatusOrder any line is in:
+// ACTIVE while any line is ACTIVE, then CONFIRMED, EXPIRED, CANCELED.
+// It doesn't depend on the order of lines.
+func cartStatus(lines []Reservation) string {
+	for _, status := range cartStatusOrder {
+		for _, l := range lines {
+			if l.Status == status {
+				return status
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package reservation
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (r *Repository) CreateCartTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	userID int64,
+	expiresAt time.Time,
+) (*Cart, error) {
+
+	query := `
+		INSERT INTO carts (user_id, expires_at)
+		VALUES ($1, $2)
+		RETURNING id, user_id, expires_at, created_at
+	`
+
+	var c Cart
+	err := tx.QueryRowContext(ctx, query, userID, expiresAt).Scan(
+		&c.ID,
+		&c.UserID,
+		&c.ExpiresAt,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// GetCart returns cart with its lines
+func (r *Repository) GetCart(ctx context.Context, id int64) (*Cart, error) {
+
+	query := `
+		SELECT id, user_id, expires_at, created_at
+		FROM carts
+		WHERE id = $1
+	`
+
+	var c Cart
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&c.ID,
+		&c.UserID,
+		&c.ExpiresAt,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, cartLinesQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c.Lines, err = scanReservations(rows)
+	if err != nil {
+		return nil, err
+	}
+	c.Status = cartStatus(c.Lines)
+
+	return &c, nil
+}
+
+// GetCartLinesForUpdate locks cart lines in product_id order — the same
+// order in which stock rows are touched, so cart operations can't deadlock
+func (r *Repository) GetCartLinesForUpdate(
+	ctx context.Context,
+	tx *sql.Tx,
+	cartID int64,
+) ([]Reservation, error) {
+
+	rows, err := tx.QueryContext(ctx, cartLinesQuery+" FOR UPDATE", cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanReservations(rows)
+}
+
+const cartLinesQuery = `
+	SELECT ` + reservationColumns + `
+	FROM reservations
+	WHERE cart_id = $1
+	ORDER BY product_id
+`
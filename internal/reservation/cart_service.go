@@ -0,0 +1,364 @@
+package reservation
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"flash-sale-reservation/internal/product"
+	"flash-sale-reservation/internal/queue"
+)
+
+// CreateCart holds every item or nothing. Items for the same product are
+// merged and products are locked in ascending id order, so two carts
+// sharing products can't deadlock each other.
+func (s *Service) CreateCart(
+	ctx context.Context,
+	userID int64,
+	items []CartItem,
+) (*Cart, error) {
+
+	items, err := normalizeCartItems(items)
+	if err != nil {
+		return nil, err
+	}
+
+	// 0. Redis-фильтр по каждой строке; при отказе откатываем уже взятое
+	var gated []CartItem
+	releaseGated := func() {
+		for _, it := range gated {
+			s.gateRelease(ctx, it.ProductID, it.Quantity)
+		}
+	}
+
+	for _, it := range items {
+		ok, err := s.gateReserve(ctx, it.ProductID, it.Quantity)
+		if err != nil {
+			releaseGated()
+			return nil, fmt.Errorf("product %d: %w", it.ProductID, err)
+		}
+		if ok {
+			gated = append(gated, it)
+		}
+	}
+
+	cart, levels, err := s.createCartTx(ctx, userID, items)
+	if err != nil {
+		releaseGated()
+		return nil, err
+	}
+
+	// один ключ на корзину: строки истекают вместе
+	_ = s.redis.Set(ctx, CartTTLKey(cart.ID), "active", time.Until(cart.ExpiresAt)).Err()
+	_ = s.redis.IncrBy(ctx, "metrics:reservations:created", int64(len(cart.Lines))).Err()
+
+	for _, level := range levels {
+		s.publishStock(ctx, level)
+	}
+
+	return cart, nil
+}
+
+func (s *Service) createCartTx(
+	ctx context.Context,
+	userID int64,
+	items []CartItem,
+) (*Cart, []product.StockLevel, error) {
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// у корзины один срок на все строки — самый короткий из товаров
+	now := time.Now()
+	hold := time.Duration(0)
+	products := make(map[int64]*product.Product, len(items))
+	for _, it := range items {
+		p, err := s.productRepo.GetByIDTx(ctx, tx, it.ProductID)
+		if err != nil {
+			return nil, nil, notFound(err, "product", it.ProductID)
+		}
+		if err := p.CheckSaleWindow(now); err != nil {
+			return nil, nil, fmt.Errorf("product %d: %w", it.ProductID, err)
+		}
+		if err := s.checkNoRaffleTx(ctx, tx, it.ProductID); err != nil {
+			return nil, nil, fmt.Errorf("product %d: %w", it.ProductID, err)
+		}
+		if p.Queued {
+			return nil, nil, fmt.Errorf("product %d: %w, reserve it via POST /reservations", it.ProductID, queue.ErrTokenRequired)
+		}
+		if h := p.InitialHold(s.defaultHold); hold == 0 || h < hold {
+			hold = h
+		}
+		products[it.ProductID] = p
+	}
+
+	if err := s.checkLimitsTx(ctx, tx, userID, items, products, true); err != nil {
+		return nil, nil, err
+	}
+
+	cart, err := s.repo.CreateCartTx(ctx, tx, userID, now.Add(hold))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	levels := make([]product.StockLevel, 0, len(items))
+
+	// items отсортированы по product_id
+	for _, it := range items {
+		hasActive, err := s.repo.HasActiveReservationTx(ctx, tx, it.ProductID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hasActive {
+			return nil, nil, fmt.Errorf("product %d: %w", it.ProductID, ErrAlreadyReserved)
+		}
+
+		level, err := s.productRepo.DecreaseStockTx(ctx, tx, it.ProductID, it.Quantity)
+		if err != nil {
+			return nil, nil, fmt.Errorf("product %d: %w", it.ProductID, err)
+		}
+
+		line, err := s.repo.CreateTx(ctx, tx, it.ProductID, userID, it.Quantity, cart.ExpiresAt, &cart.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("product %d: %w", it.ProductID, err)
+		}
+
+		if err := s.emitCreatedTx(ctx, tx, line, level.Stock); err != nil {
+			return nil, nil, err
+		}
+
+		cart.Lines = append(cart.Lines, *line)
+		levels = append(levels, level)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	cart.Status = StatusActive
+
+	return cart, levels, nil
+}
+
+func (s *Service) GetCart(ctx context.Context, id, userID int64) (*Cart, error) {
+	c, err := s.repo.GetCart(ctx, id)
+	if err != nil {
+		return nil, notFound(err, "cart", id)
+	}
+	if err := checkOwnedBy(c.UserID, userID); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ConfirmCart confirms all lines of a cart of userID at once; fails if any
+// line is no longer ACTIVE
+func (s *Service) ConfirmCart(ctx context.Context, id, userID int64) error {
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lines, err := s.repo.GetCartLinesForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("cart %d %w", id, ErrNotFound)
+	}
+	if err := checkOwnedBy(lines[0].UserID, userID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range lines {
+		if err := checkNotExpired(&lines[i], now); err != nil {
+			return fmt.Errorf("cart line %d: %w", lines[i].ID, err)
+		}
+		if err := Transitions.Check(lines[i].Status, StatusConfirmed); err != nil {
+			return fmt.Errorf("cart line %d: %w", lines[i].ID, err)
+		}
+	}
+
+	for i := range lines {
+		if err := s.repo.UpdateStatusTx(ctx, tx, lines[i].ID, lines[i].Status, StatusConfirmed, StatusChange{Actor: ActorUser, At: now}); err != nil {
+			return err
+		}
+		if err := s.emitConfirmedTx(ctx, tx, &lines[i], now); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.dropCartTTL(ctx, id)
+
+	_ = s.redis.IncrBy(ctx, "metrics:reservations:confirmed", int64(len(lines))).Err()
+
+	return nil
+}
+
+// CancelCart cancels all lines that are still ACTIVE and returns their stock
+func (s *Service) CancelCart(ctx context.Context, id int64, c Cancellation) error {
+
+	if err := c.normalize(); err != nil {
+		return err
+	}
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lines, err := s.repo.GetCartLinesForUpdate(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("cart %d %w", id, ErrNotFound)
+	}
+	if err := c.checkOwner(lines[0].UserID); err != nil {
+		return err
+	}
+	if status := cartStatus(lines); status != StatusActive {
+		return fmt.Errorf("%w: cart is %s, only ACTIVE can be canceled", ErrInvalidTransition, status)
+	}
+
+	var (
+		now      = time.Now()
+		canceled []Reservation
+		levels   []product.StockLevel
+		promoted [][]Reservation
+		change   = c.statusChange()
+	)
+	change.At = now
+
+	// строки идут по product_id — тот же порядок блокировок, что и при создании
+	for i := range lines {
+		line := &lines[i]
+		if !Transitions.Can(line.Status, StatusCanceled) {
+			continue
+		}
+
+		level, err := s.productRepo.IncreaseStockTx(ctx, tx, line.ProductID, line.Quantity)
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.UpdateStatusTx(ctx, tx, line.ID, line.Status, StatusCanceled, change); err != nil {
+			return err
+		}
+
+		if err := s.emitCanceledTx(ctx, tx, line, level.Stock, c, now); err != nil {
+			return err
+		}
+
+		lp, level, err := s.promoteWaitlistTx(ctx, tx, level, now)
+		if err != nil {
+			return err
+		}
+
+		canceled = append(canceled, *line)
+		levels = append(levels, level)
+		promoted = append(promoted, lp)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.dropCartTTL(ctx, id)
+	s.countCanceled(ctx, c.Reason, len(canceled))
+
+	for i, line := range canceled {
+		s.afterPromotion(ctx, line.ProductID, line.Quantity, promoted[i])
+		s.publishStock(ctx, levels[i])
+	}
+
+	return nil
+}
+
+// ExpireCart expires all ACTIVE lines of a cart in one transaction once the
+// cart's expires_at has passed according to the database, so the cart never
+// shows up half expired. Returns false when there was nothing to expire.
+func (s *Service) ExpireCart(ctx context.Context, id int64) (bool, error) {
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	lines, err := s.repo.GetCartLinesForUpdate(ctx, tx, id)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	var active []Reservation
+	for _, line := range lines {
+		if line.Status != StatusActive {
+			continue
+		}
+		// у строк корзины общий срок
+		if line.ExpiresAt.After(now) {
+			return false, nil
+		}
+		active = append(active, line)
+	}
+	if len(active) == 0 {
+		return false, nil
+	}
+
+	if err := s.expireLocked(ctx, tx, active, now); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// normalizeCartItems validates items, merges duplicates and sorts by product_id
+func normalizeCartItems(items []CartItem) ([]CartItem, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: cart must contain at least one item", ErrInvalidInput)
+	}
+
+	byProduct := make(map[int64]int)
+	for _, it := range items {
+		if it.ProductID <= 0 {
+			return nil, fmt.Errorf("%w: product_id must be > 0", ErrInvalidInput)
+		}
+		if it.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be > 0", ErrInvalidInput)
+		}
+		byProduct[it.ProductID] += it.Quantity
+	}
+
+	if len(byProduct) > MaxCartLines {
+		return nil, fmt.Errorf("%w: cart can contain at most %d products", ErrInvalidInput, MaxCartLines)
+	}
+
+	result := make([]CartItem, 0, len(byProduct))
+	for productID, qty := range byProduct {
+		if qty > MaxQuantity {
+			return nil, fmt.Errorf("%w: product %d: quantity must be between 1 and %d", ErrInvalidInput, productID, MaxQuantity)
+		}
+		result = append(result, CartItem{ProductID: productID, Quantity: qty})
+	}
+
+	slices.SortFunc(result, func(a, b CartItem) int {
+		return cmp.Compare(a.ProductID, b.ProductID)
+	})
+
+	return result, nil
+}
@@ -0,0 +1,31 @@
+package reservation
+
+import "testing"
+
+func TestCartStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"no lines", nil, ""},
+		{"all active", []string{StatusActive, StatusActive}, StatusActive},
+		{"one line still active", []string{StatusCanceled, StatusActive}, StatusActive},
+		{"confirmed", []string{StatusConfirmed, StatusConfirmed}, StatusConfirmed},
+		{"canceled", []string{StatusCanceled, StatusCanceled}, StatusCanceled},
+		// одна строка снята с окончанием распродажи, остальные истекли
+		{"canceled then expired", []string{StatusCanceled, StatusExpired}, StatusExpired},
+		{"expired then canceled", []string{StatusExpired, StatusCanceled}, StatusExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make([]Reservation, len(tt.lines))
+			for i, status := range tt.lines {
+				lines[i] = Reservation{Status: status}
+			}
+			if got := cartStatus(lines); got != tt.want {
+				t.Errorf("cartStatus(%v) = %q, want %q", tt.lines, got, tt.want)
+			}
+		})
+	}
+}
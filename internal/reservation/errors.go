@@ -0,0 +1,64 @@
+package reservation
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"flash-sale-reservation/internal/product"
+)
+
+// Ошибки сервиса. Подробности добавляются через %w, вызывающий код
+// различает их через errors.Is; internal/http отображает их в статусы.
+var (
+	// ErrOutOfStock — единиц товара меньше, чем запрошено
+	ErrOutOfStock = product.ErrOutOfStock
+	// ErrAlreadyReserved — у пользователя уже есть ACTIVE резерв товара
+	ErrAlreadyReserved = errors.New("active reservation already exists")
+	ErrNotFound        = errors.New("not found")
+	// ErrInvalidTransition — операция недопустима в текущем статусе
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrExpired — срок резерва уже вышел
+	ErrExpired = errors.New("reservation has expired")
+	// ErrForbidden — операция над чужим резервом
+	ErrForbidden = errors.New("forbidden")
+	// ErrInvalidInput — запрос отклонён проверкой полей
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrUnavailable — зависимость (например, очередь в Redis) недоступна
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// notFound turns sql.ErrNoRows into ErrNotFound naming the missing thing,
+// e.g. "reservation 42 not found"; other errors pass through
+func notFound(err error, what string, id int64) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s %d %w", what, id, ErrNotFound)
+	}
+	return err
+}
+
+// checkOwnedBy rejects an operation by userID on a reservation, cart or
+// waitlist entry of owner
+func checkOwnedBy(owner, userID int64) error {
+	if owner != userID {
+		return fmt.Errorf("%w: it belongs to another user", ErrForbidden)
+	}
+	return nil
+}
+
+// SQLSTATE нарушений ограничений, которые отображаются в ошибки сервиса
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// isViolation reports a PostgreSQL violation with SQLSTATE code of the
+// named constraint or unique index
+func isViolation(err error, code, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		pgErr.Code == code &&
+		pgErr.ConstraintName == constraint
+}
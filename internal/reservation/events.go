@@ -0,0 +1,213 @@
+package reservation
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"flash-sale-reservation/internal/events"
+)
+
+// Outbox-события пишутся в той же транзакции, что и изменение резерва/stock
+
+func (s *Service) emitStockChangedTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	productID int64,
+	delta int,
+	stock int,
+	reason string,
+	reservationID *int64,
+	at time.Time,
+) error {
+
+	return s.outboxRepo.InsertTx(ctx, tx, events.StockChanged{
+		ProductID:     productID,
+		Delta:         delta,
+		Stock:         stock,
+		Reason:        reason,
+		ReservationID: reservationID,
+		ChangedAt:     at,
+	})
+}
+
+func (s *Service) emitCreatedTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	res *Reservation,
+	stock int,
+) error {
+
+	if err := s.outboxRepo.InsertTx(ctx, tx, events.ReservationCreated{
+		ReservationID: res.ID,
+		ProductID:     res.ProductID,
+		UserID:        res.UserID,
+		Quantity:      res.Quantity,
+		CartID:        res.CartID,
+		ExpiresAt:     res.ExpiresAt,
+		CreatedAt:     res.CreatedAt,
+	}); err != nil {
+		return err
+	}
+
+	return s.emitStockChangedTx(ctx, tx, res.ProductID, -res.Quantity, stock, events.StockReasonReserved, &res.ID, res.CreatedAt)
+}
+
+func (s *Service) emitConfirmedTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	res *Reservation,
+	at time.Time,
+) error {
+
+	return s.outboxRepo.InsertTx(ctx, tx, events.ReservationConfirmed{
+		ReservationID: res.ID,
+		ProductID:     res.ProductID,
+		UserID:        res.UserID,
+		Quantity:      res.Quantity,
+		CartID:        res.CartID,
+		ConfirmedAt:   at,
+	})
+}
+
+func (s *Service) emitCanceledTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	res *Reservation,
+	stock int,
+	c Cancellation,
+	at time.Time,
+) error {
+
+	if err := s.outboxRepo.InsertTx(ctx, tx, events.ReservationCanceled{
+		ReservationID: res.ID,
+		ProductID:     res.ProductID,
+		UserID:        res.UserID,
+		Quantity:      res.Quantity,
+		CartID:        res.CartID,
+		Reason:        c.Reason,
+		Actor:         c.Actor,
+		CanceledAt:    at,
+	}); err != nil {
+		return err
+	}
+
+	return s.emitStockChangedTx(ctx, tx, res.ProductID, res.Quantity, stock, events.StockReasonCanceled, &res.ID, at)
+}
+
+// emitExpiredTx writes only ReservationExpired: for batches StockChanged
+// is emitted once per product by the caller.
+func (s *Service) emitExpiredTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	res *Reservation,
+	at time.Time,
+) error {
+
+	return s.outboxRepo.InsertTx(ctx, tx, events.ReservationExpired{
+		ReservationID: res.ID,
+		ProductID:     res.ProductID,
+		UserID:        res.UserID,
+		Quantity:      res.Quantity,
+		CartID:        res.CartID,
+		ExpiresAt:     res.ExpiresAt,
+		ExpiredAt:     at,
+	})
+}
+
+// emitSaleEndedTx writes ReservationCanceled for a hold released at the end
+// of a sale; StockChanged is emitted once per product by the caller.
+func (s *Service) emitSaleEndedTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	res *Reservation,
+	at time.Time,
+) error {
+
+	return s.outboxRepo.InsertTx(ctx, tx, events.ReservationCanceled{
+		ReservationID: res.ID,
+		ProductID:     res.ProductID,
+		UserID:        res.UserID,
+		Quantity:      res.Quantity,
+		CartID:        res.CartID,
+		Reason:        CancelSaleEnded,
+		Actor:         ActorSystem,
+		CanceledAt:    at,
+	})
+}
+
+func (s *Service) emitExtendedTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	res *Reservation,
+	previous time.Time,
+	at time.Time,
+) error {
+
+	return s.outboxRepo.InsertTx(ctx, tx, events.ReservationExtended{
+		ReservationID:     res.ID,
+		ProductID:         res.ProductID,
+		UserID:            res.UserID,
+		Quantity:          res.Quantity,
+		PreviousExpiresAt: previous,
+		ExpiresAt:         res.ExpiresAt,
+		Extensions:        res.Extensions,
+		ExtendedAt:        at,
+	})
+}
+
+func (s *Service) emitRaffleWonTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	r *Raffle,
+	res *Reservation,
+	at time.Time,
+) error {
+
+	return s.outboxRepo.InsertTx(ctx, tx, events.RaffleWon{
+		RaffleID:      r.ID,
+		ProductID:     r.ProductID,
+		UserID:        res.UserID,
+		ReservationID: res.ID,
+		Quantity:      res.Quantity,
+		ExpiresAt:     res.ExpiresAt,
+		DrawnAt:       at,
+	})
+}
+
+func (s *Service) emitRaffleLostTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	r *Raffle,
+	userID int64,
+	reason string,
+	at time.Time,
+) error {
+
+	return s.outboxRepo.InsertTx(ctx, tx, events.RaffleLost{
+		RaffleID:  r.ID,
+		ProductID: r.ProductID,
+		UserID:    userID,
+		Reason:    reason,
+		DrawnAt:   at,
+	})
+}
+
+func (s *Service) emitWaitlistPromotedTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	entry *WaitlistEntry,
+	res *Reservation,
+	at time.Time,
+) error {
+
+	return s.outboxRepo.InsertTx(ctx, tx, events.WaitlistPromoted{
+		WaitlistID:    entry.ID,
+		ProductID:     res.ProductID,
+		UserID:        res.UserID,
+		ReservationID: res.ID,
+		Quantity:      res.Quantity,
+		ExpiresAt:     res.ExpiresAt,
+		PromotedAt:    at,
+	})
+}
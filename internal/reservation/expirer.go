@@ -0,0 +1,65 @@
+package reservation
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Expirer periodically moves overdue ACTIVE reservations to EXPIRED
+// and returns their stock to the product.
+// Several expirers (in one process or across instances) may run in
+// parallel: batches are claimed with SKIP LOCKED.
+type Expirer struct {
+	service   *Service
+	interval  time.Duration
+	batchSize int
+}
+
+func NewExpirer(service *Service, interval time.Duration, batchSize int) *Expirer {
+	return &Expirer{
+		service:   service,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run sweeps once immediately and then on every tick until ctx is canceled.
+func (e *Expirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	log.Printf("expiry sweeper started, interval=%s batch=%d", e.interval, e.batchSize)
+
+	e.sweep(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("expiry sweeper stopped")
+			return
+		case <-ticker.C:
+			e.sweep(ctx)
+		}
+	}
+}
+
+func (e *Expirer) sweep(ctx context.Context) {
+	started := time.Now()
+
+	count, err := e.service.ExpireReservationsBatched(ctx, e.batchSize)
+	if err != nil {
+		// при остановке транзакция просто откатывается
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("expiry sweep failed: %v", err)
+		return
+	}
+
+	log.Printf(
+		"expiry sweep done: expired=%d took=%s",
+		count,
+		time.Since(started).Round(time.Millisecond),
+	)
+}
@@ -0,0 +1,131 @@
+package reservation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TTLKeyPrefix is the prefix of reservation:{id} keys whose Redis TTL
+// mirrors expires_at
+const TTLKeyPrefix = "reservation:"
+
+func TTLKey(id int64) string {
+	return fmt.Sprintf("%s%d", TTLKeyPrefix, id)
+}
+
+// CartTTLKeyPrefix is the prefix of cart:{id} keys. A cart has one key for
+// all its lines, so its lines expire together.
+const CartTTLKeyPrefix = "cart:"
+
+func CartTTLKey(id int64) string {
+	return fmt.Sprintf("%s%d", CartTTLKeyPrefix, id)
+}
+
+// ExpiryListener expires a reservation as soon as its reservation:{id}
+// TTL key expires in Redis, and a whole cart when its cart:{id} key does. PostgreSQL stays the source of truth: the
+// event only triggers a check, and the Expirer sweep remains the
+// fallback for missed notifications (Redis pub/sub is fire-and-forget).
+type ExpiryListener struct {
+	service *Service
+	redis   *redis.Client
+}
+
+func NewExpiryListener(service *Service, redis *redis.Client) *ExpiryListener {
+	return &ExpiryListener{
+		service: service,
+		redis:   redis,
+	}
+}
+
+// Run subscribes to expired-key events and blocks until ctx is canceled.
+func (l *ExpiryListener) Run(ctx context.Context) {
+	if err := l.enableNotifications(ctx); err != nil {
+		// на managed Redis CONFIG SET бывает запрещён — тогда настройка на стороне Redis
+		log.Printf("expiry listener: cannot enable keyspace notifications: %v", err)
+	}
+
+	channel := fmt.Sprintf("__keyevent@%d__:expired", l.redis.Options().DB)
+
+	pubsub := l.redis.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	log.Printf("expiry listener subscribed to %s", channel)
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("expiry listener stopped")
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			l.handle(ctx, msg.Payload)
+		}
+	}
+}
+
+func (l *ExpiryListener) handle(ctx context.Context, key string) {
+	var (
+		what   string
+		expire func(context.Context, int64) (bool, error)
+		prefix string
+	)
+	switch {
+	case strings.HasPrefix(key, TTLKeyPrefix):
+		what, expire, prefix = "reservation", l.service.ExpireByID, TTLKeyPrefix
+	case strings.HasPrefix(key, CartTTLKeyPrefix):
+		what, expire, prefix = "cart", l.service.ExpireCart, CartTTLKeyPrefix
+	default:
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 64)
+	if err != nil {
+		return
+	}
+
+	expired, err := expire(ctx, id)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("expiry listener: %s %d: %v", what, id, err)
+		return
+	}
+
+	if expired {
+		log.Printf("expiry listener: %s %d expired", what, id)
+	}
+}
+
+// enableNotifications adds the E (keyevent) and x (expired) flags
+// to notify-keyspace-events, keeping whatever is configured already.
+func (l *ExpiryListener) enableNotifications(ctx context.Context) error {
+	current, err := l.redis.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+
+	flags := current["notify-keyspace-events"]
+	for _, f := range []string{"E", "x"} {
+		if f == "x" && strings.Contains(flags, "A") {
+			continue
+		}
+		if !strings.Contains(flags, f) {
+			flags += f
+		}
+	}
+
+	if flags == current["notify-keyspace-events"] {
+		return nil
+	}
+
+	return l.redis.ConfigSet(ctx, "notify-keyspace-events", flags).Err()
+}
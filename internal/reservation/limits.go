@@ -0,0 +1,126 @@
+package reservation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"flash-sale-reservation/internal/product"
+)
+
+// ErrLimitExceeded is returned when a hold would take the user over the
+// max_per_user of a product or of its campaign
+var ErrLimitExceeded = errors.New("purchase limit exceeded")
+
+// errLimitBusy — блокировка лимита занята, а ждать нельзя
+var errLimitBusy = errors.New("purchase limit check is busy")
+
+// Области advisory-блокировок лимитов
+const (
+	limitScopeProduct  = "product"
+	limitScopeCampaign = "campaign"
+)
+
+// checkLimitsTx enforces per-user limits for items about to be held.
+// Units in ACTIVE and CONFIRMED reservations count against the limit.
+// Each check runs under a per-user advisory lock held until commit, so two
+// concurrent holds of the same user can't both see the old total. Locks
+// are taken campaigns first, then products, each in ascending id order;
+// items must be sorted by product_id. With wait = false a busy lock
+// returns errLimitBusy instead of blocking: callers already holding
+// product rows must not wait for a hold that is about to lock them.
+func (s *Service) checkLimitsTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	userID int64,
+	items []CartItem,
+	products map[int64]*product.Product,
+	wait bool,
+) error {
+
+	byCampaign := make(map[int64]int)
+	for _, it := range items {
+		if p := products[it.ProductID]; p.CampaignID != nil {
+			byCampaign[*p.CampaignID] += it.Quantity
+		}
+	}
+
+	campaignIDs := make([]int64, 0, len(byCampaign))
+	for id := range byCampaign {
+		campaignIDs = append(campaignIDs, id)
+	}
+	slices.Sort(campaignIDs)
+
+	for _, id := range campaignIDs {
+		c, err := s.productRepo.GetCampaignTx(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := s.lockUserLimitTx(ctx, tx, limitScopeCampaign, userID, id, wait); err != nil {
+			return err
+		}
+
+		held, err := s.repo.HeldInCampaignTx(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+
+		if held+byCampaign[id] > c.MaxPerUser {
+			return fmt.Errorf(
+				"%w: campaign %d allows %d units per user, %d already held",
+				ErrLimitExceeded, id, c.MaxPerUser, held,
+			)
+		}
+	}
+
+	// items отсортированы по product_id
+	for _, it := range items {
+		p := products[it.ProductID]
+		if p.MaxPerUser == nil {
+			continue
+		}
+
+		if err := s.lockUserLimitTx(ctx, tx, limitScopeProduct, userID, p.ID, wait); err != nil {
+			return err
+		}
+
+		held, err := s.repo.HeldInProductTx(ctx, tx, userID, p.ID)
+		if err != nil {
+			return err
+		}
+
+		if held+it.Quantity > *p.MaxPerUser {
+			return fmt.Errorf(
+				"%w: product %d allows %d units per user, %d already held",
+				ErrLimitExceeded, p.ID, *p.MaxPerUser, held,
+			)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) lockUserLimitTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	scope string,
+	userID, id int64,
+	wait bool,
+) error {
+
+	if wait {
+		return s.repo.LockUserLimitTx(ctx, tx, scope, userID, id)
+	}
+
+	locked, err := s.repo.TryLockUserLimitTx(ctx, tx, scope, userID, id)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errLimitBusy
+	}
+	return nil
+}
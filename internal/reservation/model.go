@@ -6,7 +6,15 @@ type Reservation struct {
 	ID        int64     `json:"id"`
 	ProductID int64     `json:"product_id"`
 	UserID    int64     `json:"user_id"`
+	Quantity  int       `json:"quantity"`
 	Status    string    `json:"status"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
+	// CartID != nil — резерв является строкой корзины
+	CartID *int64 `json:"cart_id,omitempty"`
+	// Extensions — сколько раз резерв уже продлевали
+	Extensions int `json:"extensions"`
+	// CancelReason и CanceledBy заполнены у CANCELED резерва
+	CancelReason *string `json:"cancel_reason,omitempty"`
+	CanceledBy   *string `json:"canceled_by,omitempty"`
 }
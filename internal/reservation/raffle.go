@@ -0,0 +1,217 @@
+package reservation
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mrand "math/rand/v2"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// OPEN → CLOSED (набор участников зафиксирован) → DRAWN (seed раскрыт)
+const (
+	RaffleOpen   = "OPEN"
+	RaffleClosed = "CLOSED"
+	RaffleDrawn  = "DRAWN"
+)
+
+// Итог участия в розыгрыше
+const (
+	EntryWon       = "WON"
+	EntryLost      = "LOST"
+	EntryForfeited = "FORFEITED"
+)
+
+// ErrRaffleOnly rejects direct holds of a product with an open raffle
+var ErrRaffleOnly = errors.New("product is allocated by raffle")
+
+// Raffle allocates a product by a seeded random draw instead of first
+// come, first served. Seed stays hidden until the draw — it isn't even
+// stored, only derived from the service secret and SeedNonce; SeedHash is
+// published from the start so the seed can't be picked afterwards.
+// EntrantsHash is published when registration closes, before the seed is
+// revealed, so entrants can't be added or dropped once the order is known.
+type Raffle struct {
+	ID                 int64      `json:"id"`
+	ProductID          int64      `json:"product_id"`
+	Quantity           int        `json:"quantity"`
+	RegistrationEndsAt time.Time  `json:"registration_ends_at"`
+	Status             string     `json:"status"`
+	Seed               string     `json:"seed,omitempty"`
+	SeedHash           string     `json:"seed_hash"`
+	SeedNonce          string     `json:"-"`
+	EntrantsHash       *string    `json:"entrants_hash,omitempty"`
+	Winners            *int       `json:"winners,omitempty"`
+	ClosedAt           *time.Time `json:"closed_at,omitempty"`
+	DrawnAt            *time.Time `json:"drawn_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	Entries            int        `json:"entries"`
+}
+
+type RaffleEntry struct {
+	RaffleID      int64     `json:"raffle_id"`
+	UserID        int64     `json:"user_id"`
+	Result        *string   `json:"result,omitempty"`
+	ReservationID *int64    `json:"reservation_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// RaffleVerification is the result of re-running a draw from its seed
+type RaffleVerification struct {
+	RaffleID     int64         `json:"raffle_id"`
+	Seed         string        `json:"seed"`
+	SeedHash     string        `json:"seed_hash"`
+	EntrantsHash string        `json:"entrants_hash,omitempty"`
+	Winners      int           `json:"winners"`
+	Order        []RaffleEntry `json:"order"`
+	Valid        bool          `json:"valid"`
+	Problems     []string      `json:"problems,omitempty"`
+}
+
+// newRaffleNonce returns a random 16-byte nonce, hex
+func newRaffleNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// raffleSeed derives the 32-byte seed of a raffle as
+// HMAC-SHA256(secret, nonce) and returns it with its SHA-256, both hex
+func raffleSeed(secret []byte, nonce string) (seed, hash string) {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(nonce))
+	b := mac.Sum(nil)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(b), hex.EncodeToString(sum[:])
+}
+
+// EntrantsHash is the SHA-256, hex, of userIDs sorted ascending, each
+// written in decimal and followed by "\n"
+func EntrantsHash(userIDs []int64) string {
+	sorted := slices.Clone(userIDs)
+	slices.Sort(sorted)
+
+	h := sha256.New()
+	for _, id := range sorted {
+		h.Write(strconv.AppendInt(nil, id, 10))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// DrawOrder returns userIDs in draw order for a hex seed. The order is a
+// Fisher–Yates shuffle of the ids sorted ascending, driven by ChaCha8
+// seeded with the 32 seed bytes; indexes are drawn by rejection sampling
+// from raw Uint64 outputs, so the result depends only on the seed and the
+// ids and can be reproduced outside this service.
+func DrawOrder(seed string, userIDs []int64) ([]int64, error) {
+	b, err := hex.DecodeString(seed)
+	if err != nil || len(b) != 32 {
+		return nil, fmt.Errorf("seed must be 32 bytes hex")
+	}
+
+	var key [32]byte
+	copy(key[:], b)
+	src := mrand.NewChaCha8(key)
+
+	order := slices.Clone(userIDs)
+	slices.Sort(order)
+
+	for i := len(order) - 1; i > 0; i-- {
+		j := uniformIndex(src, uint64(i+1))
+		order[i], order[j] = order[j], order[i]
+	}
+
+	return order, nil
+}
+
+// uniformIndex returns a uniform value in [0, n): outputs below 2^64 mod n
+// are rejected so every remainder is equally likely
+func uniformIndex(src *mrand.ChaCha8, n uint64) uint64 {
+	threshold := -n % n
+	for {
+		if v := src.Uint64(); v >= threshold {
+			return v % n
+		}
+	}
+}
+
+// verifyRaffle checks recorded results against the order recomputed from
+// the seed: entries are drawn in order until stock runs out, so results
+// must read WON/FORFEITED first and LOST after, with exactly Winners WON.
+func verifyRaffle(r *Raffle, entries []RaffleEntry) (*RaffleVerification, error) {
+	v := &RaffleVerification{
+		RaffleID: r.ID,
+		Seed:     r.Seed,
+		SeedHash: r.SeedHash,
+	}
+	if r.EntrantsHash != nil {
+		v.EntrantsHash = *r.EntrantsHash
+	}
+	if r.Winners != nil {
+		v.Winners = *r.Winners
+	}
+
+	seed, err := hex.DecodeString(r.Seed)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(seed); hex.EncodeToString(sum[:]) != r.SeedHash {
+		v.Problems = append(v.Problems, "seed does not match seed_hash")
+	}
+
+	byUser := make(map[int64]RaffleEntry, len(entries))
+	userIDs := make([]int64, 0, len(entries))
+	for _, e := range entries {
+		byUser[e.UserID] = e
+		userIDs = append(userIDs, e.UserID)
+	}
+
+	// розыгрыши до entrants_hash его не имеют
+	if r.EntrantsHash != nil && EntrantsHash(userIDs) != *r.EntrantsHash {
+		v.Problems = append(v.Problems, "entries do not match entrants_hash committed at close")
+	}
+
+	order, err := DrawOrder(r.Seed, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	won, lost := 0, false
+	for pos, userID := range order {
+		e := byUser[userID]
+		v.Order = append(v.Order, e)
+
+		result := ""
+		if e.Result != nil {
+			result = *e.Result
+		}
+
+		switch {
+		case result == EntryLost:
+			lost = true
+		case !lost && result == EntryWon:
+			won++
+		case !lost && result == EntryForfeited:
+		default:
+			v.Problems = append(v.Problems, fmt.Sprintf(
+				"position %d, user %d: result %q is out of draw order", pos+1, userID, result,
+			))
+		}
+	}
+
+	if won != v.Winners {
+		v.Problems = append(v.Problems, fmt.Sprintf("%d WON entries, raffle records %d winners", won, v.Winners))
+	}
+
+	v.Valid = len(v.Problems) == 0
+
+	return v, nil
+}
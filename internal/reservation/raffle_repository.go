@@ -0,0 +1,320 @@
+package reservation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const raffleColumns = `
+	id, product_id, quantity, registration_ends_at, status,
+	COALESCE(seed, ''), seed_hash, seed_nonce, entrants_hash,
+	winners, closed_at, drawn_at, created_at,
+	(SELECT count(*) FROM raffle_entries e WHERE e.raffle_id = raffles.id)
+`
+
+func scanRaffle(row rowScanner) (*Raffle, error) {
+	var r Raffle
+	if err := row.Scan(
+		&r.ID,
+		&r.ProductID,
+		&r.Quantity,
+		&r.RegistrationEndsAt,
+		&r.Status,
+		&r.Seed,
+		&r.SeedHash,
+		&r.SeedNonce,
+		&r.EntrantsHash,
+		&r.Winners,
+		&r.ClosedAt,
+		&r.DrawnAt,
+		&r.CreatedAt,
+		&r.Entries,
+	); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (r *Repository) CreateRaffle(
+	ctx context.Context,
+	productID int64,
+	quantity int,
+	registrationEndsAt time.Time,
+	seedNonce, seedHash string,
+) (*Raffle, error) {
+
+	query := `
+		INSERT INTO raffles (product_id, quantity, registration_ends_at, seed_nonce, seed_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + raffleColumns
+
+	raffle, err := scanRaffle(r.db.QueryRowContext(ctx, query, productID, quantity, registrationEndsAt, seedNonce, seedHash))
+	switch {
+	case isViolation(err, pgForeignKeyViolation, "raffles_product_id_fkey"):
+		return nil, fmt.Errorf("product %d %w", productID, ErrNotFound)
+	case isViolation(err, pgUniqueViolation, "ux_raffles_open_product"):
+		return nil, fmt.Errorf("%w: product %d already has an open raffle", ErrInvalidTransition, productID)
+	}
+	return raffle, err
+}
+
+func (r *Repository) GetRaffle(ctx context.Context, id int64) (*Raffle, error) {
+
+	query := `
+		SELECT ` + raffleColumns + `
+		FROM raffles
+		WHERE id = $1
+	`
+
+	return scanRaffle(r.db.QueryRowContext(ctx, query, id))
+}
+
+// GetRaffleForUpdate locks the raffle: entries wait for the draw and back
+func (r *Repository) GetRaffleForUpdate(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+) (*Raffle, error) {
+
+	query := `
+		SELECT ` + raffleColumns + `
+		FROM raffles
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	return scanRaffle(tx.QueryRowContext(ctx, query, id))
+}
+
+// HasOpenRaffleTx reports whether the product is being allocated by a
+// raffle not drawn yet
+func (r *Repository) HasOpenRaffleTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	productID int64,
+) (bool, error) {
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM raffles
+			WHERE product_id = $1
+			  AND status IN ('OPEN', 'CLOSED')
+		)
+	`
+
+	var exists bool
+	err := tx.QueryRowContext(ctx, query, productID).Scan(&exists)
+	return exists, err
+}
+
+// LockRaffleForEntryTx share-locks the raffle, so an entry can't slip in
+// while the draw holds it, and reports whether registration is open at now.
+// registration_ends_at is stored in UTC, so now is compared in UTC too.
+func (r *Repository) LockRaffleForEntryTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	raffleID int64,
+	now time.Time,
+) (bool, error) {
+
+	query := `
+		SELECT status = 'OPEN' AND registration_ends_at > $2
+		FROM raffles
+		WHERE id = $1
+		FOR SHARE
+	`
+
+	var open bool
+	err := tx.QueryRowContext(ctx, query, raffleID, now.UTC()).Scan(&open)
+	return open, err
+}
+
+// AddRaffleEntryTx registers the user; a repeated entry returns the existing one
+func (r *Repository) AddRaffleEntryTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	raffleID, userID int64,
+) (*RaffleEntry, error) {
+
+	query := `
+		INSERT INTO raffle_entries (raffle_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (raffle_id, user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING raffle_id, user_id, result, reservation_id, created_at
+	`
+
+	var e RaffleEntry
+	err := tx.QueryRowContext(ctx, query, raffleID, userID).Scan(
+		&e.RaffleID,
+		&e.UserID,
+		&e.Result,
+		&e.ReservationID,
+		&e.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *Repository) listRaffleEntries(ctx context.Context, q querier, raffleID int64) ([]RaffleEntry, error) {
+
+	query := `
+		SELECT raffle_id, user_id, result, reservation_id, created_at
+		FROM raffle_entries
+		WHERE raffle_id = $1
+		ORDER BY user_id
+	`
+
+	rows, err := q.QueryContext(ctx, query, raffleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []RaffleEntry
+	for rows.Next() {
+		var e RaffleEntry
+		if err := rows.Scan(
+			&e.RaffleID,
+			&e.UserID,
+			&e.Result,
+			&e.ReservationID,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *Repository) ListRaffleEntries(ctx context.Context, raffleID int64) ([]RaffleEntry, error) {
+	return r.listRaffleEntries(ctx, r.db, raffleID)
+}
+
+func (r *Repository) ListRaffleEntriesTx(ctx context.Context, tx *sql.Tx, raffleID int64) ([]RaffleEntry, error) {
+	return r.listRaffleEntries(ctx, tx, raffleID)
+}
+
+// SetEntryResultTx records the draw result of one entry
+func (r *Repository) SetEntryResultTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	raffleID, userID int64,
+	result string,
+	reservationID *int64,
+) error {
+
+	query := `
+		UPDATE raffle_entries
+		SET result = $3,
+		    reservation_id = $4
+		WHERE raffle_id = $1
+		  AND user_id = $2
+	`
+
+	_, err := tx.ExecContext(ctx, query, raffleID, userID, result, reservationID)
+	return err
+}
+
+// MarkRestLostTx records LOST for every entry without a result yet
+func (r *Repository) MarkRestLostTx(ctx context.Context, tx *sql.Tx, raffleID int64) error {
+
+	query := `
+		UPDATE raffle_entries
+		SET result = 'LOST'
+		WHERE raffle_id = $1
+		  AND result IS NULL
+	`
+
+	_, err := tx.ExecContext(ctx, query, raffleID)
+	return err
+}
+
+// ListEndedOpenRaffles returns ids of raffles whose registration is over
+// at now (compared in UTC, like LockRaffleForEntryTx) but which are still
+// OPEN
+func (r *Repository) ListEndedOpenRaffles(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+
+	query := `
+		SELECT id
+		FROM raffles
+		WHERE status = 'OPEN'
+		  AND registration_ends_at <= $1
+		ORDER BY registration_ends_at
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// CloseRaffleTx ends registration and records the entrant set
+func (r *Repository) CloseRaffleTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+	entrantsHash string,
+	closedAt time.Time,
+) error {
+
+	query := `
+		UPDATE raffles
+		SET status = 'CLOSED',
+		    entrants_hash = $2,
+		    closed_at = $3
+		WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, id, entrantsHash, closedAt)
+	return err
+}
+
+// MarkRaffleDrawnTx records the result and reveals the seed
+func (r *Repository) MarkRaffleDrawnTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+	winners int,
+	seed string,
+	drawnAt time.Time,
+) error {
+
+	query := `
+		UPDATE raffles
+		SET status = 'DRAWN',
+		    winners = $2,
+		    seed = $3,
+		    drawn_at = $4
+		WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, id, winners, seed, drawnAt)
+	return err
+}
+
+// querier is what *sql.DB and *sql.Tx have in common
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
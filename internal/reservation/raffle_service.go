@@ -0,0 +1,341 @@
+package reservation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"flash-sale-reservation/internal/events"
+	"flash-sale-reservation/internal/product"
+)
+
+// CreateRaffle opens registration for a product until registrationEndsAt.
+// While the raffle is open the product can't be reserved directly.
+func (s *Service) CreateRaffle(
+	ctx context.Context,
+	productID int64,
+	quantity int,
+	registrationEndsAt time.Time,
+) (*Raffle, error) {
+
+	if quantity <= 0 || quantity > MaxQuantity {
+		return nil, fmt.Errorf("%w: quantity must be between 1 and %d", ErrInvalidInput, MaxQuantity)
+	}
+	if !registrationEndsAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: registration_ends_at must be in the future", ErrInvalidInput)
+	}
+	if len(s.raffleSecret) == 0 {
+		return nil, fmt.Errorf("%w: raffles need RAFFLE_SEED_SECRET", ErrUnavailable)
+	}
+
+	// в БД — только nonce и хеш; seed выводится заново при розыгрыше
+	nonce, err := newRaffleNonce()
+	if err != nil {
+		return nil, err
+	}
+	_, hash := raffleSeed(s.raffleSecret, nonce)
+
+	// колонка TIMESTAMP без зоны: храним UTC
+	return s.repo.CreateRaffle(ctx, productID, quantity, registrationEndsAt.UTC(), nonce, hash)
+}
+
+// GetRaffle returns the raffle; the seed is revealed only after the draw
+func (s *Service) GetRaffle(ctx context.Context, id int64) (*Raffle, error) {
+	r, err := s.repo.GetRaffle(ctx, id)
+	if err != nil {
+		return nil, notFound(err, "raffle", id)
+	}
+
+	if r.Status != RaffleDrawn {
+		r.Seed = ""
+	}
+	return r, nil
+}
+
+// CloseRaffle ends registration of a raffle past registration_ends_at and
+// commits to its entrants (see EntrantsHash). The hash is public from
+// here on, while the seed stays hidden until DrawRaffle.
+func (s *Service) CloseRaffle(ctx context.Context, id int64) (*Raffle, error) {
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// FOR UPDATE ждёт регистрации, держащие FOR SHARE
+	r, err := s.repo.GetRaffleForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, notFound(err, "raffle", id)
+	}
+
+	now := time.Now()
+	if r.Status != RaffleOpen {
+		return nil, fmt.Errorf("%w: raffle is already %s", ErrInvalidTransition, r.Status)
+	}
+	if now.Before(r.RegistrationEndsAt) {
+		return nil, fmt.Errorf("%w: raffle registration is still open", ErrInvalidTransition)
+	}
+
+	entries, err := s.repo.ListRaffleEntriesTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CloseRaffleTx(ctx, tx, id, EntrantsHash(entrantIDs(entries)), now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetRaffle(ctx, id)
+}
+
+// CloseEndedRaffles closes every raffle whose registration is over; run
+// by SaleCloser so entrants are committed without waiting for an admin
+func (s *Service) CloseEndedRaffles(ctx context.Context, limit int) (int, error) {
+	if limit <= 0 {
+		limit = DefaultExpireBatchSize
+	}
+
+	ids, err := s.repo.ListEndedOpenRaffles(ctx, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	for _, id := range ids {
+		_, err := s.CloseRaffle(ctx, id)
+		if errors.Is(err, ErrInvalidTransition) {
+			// закрыл другой инстанс или админ
+			continue
+		}
+		if err != nil {
+			return closed, err
+		}
+		closed++
+	}
+
+	return closed, nil
+}
+
+// EnterRaffle registers the user; entering twice is a no-op
+func (s *Service) EnterRaffle(ctx context.Context, raffleID, userID int64) (*RaffleEntry, error) {
+
+	if userID <= 0 {
+		return nil, fmt.Errorf("%w: user_id must be > 0", ErrInvalidInput)
+	}
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	open, err := s.repo.LockRaffleForEntryTx(ctx, tx, raffleID, time.Now())
+	if err != nil {
+		return nil, notFound(err, "raffle", raffleID)
+	}
+	if !open {
+		return nil, fmt.Errorf("%w: raffle registration is closed", ErrInvalidTransition)
+	}
+
+	e, err := s.repo.AddRaffleEntryTx(ctx, tx, raffleID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, tx.Commit()
+}
+
+// DrawRaffle shuffles entrants by the raffle seed (see DrawOrder) and walks
+// the order: each drawn user gets an ACTIVE reservation of Quantity units
+// until stock runs out, everyone after that loses. A drawn user who
+// already holds the product forfeits the win to the next one.
+// Limits and the sale window don't apply: the raffle is the allocation.
+func (s *Service) DrawRaffle(ctx context.Context, id int64) (*Raffle, error) {
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	r, err := s.repo.GetRaffleForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, notFound(err, "raffle", id)
+	}
+
+	now := time.Now()
+	switch r.Status {
+	case RaffleOpen:
+		return nil, fmt.Errorf("%w: raffle registration is not closed yet", ErrInvalidTransition)
+	case RaffleDrawn:
+		return nil, fmt.Errorf("%w: raffle is already drawn", ErrInvalidTransition)
+	}
+
+	entries, err := s.repo.ListRaffleEntriesTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := entrantIDs(entries)
+	if r.EntrantsHash == nil || EntrantsHash(userIDs) != *r.EntrantsHash {
+		return nil, fmt.Errorf("raffle %d: entries do not match entrants_hash", id)
+	}
+
+	seed, err := s.revealSeed(r)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := DrawOrder(seed, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// блокируем товар: stock не меняется, пока идёт розыгрыш
+	p, err := s.productRepo.GetByIDForUpdateTx(ctx, tx, r.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		expiresAt = now.Add(p.InitialHold(s.defaultHold))
+		soldOut   = p.Stock < r.Quantity
+		winners   []Reservation
+		level     = product.StockLevel{ProductID: p.ID, Stock: p.Stock}
+	)
+
+	for _, userID := range order {
+		if soldOut {
+			if err := s.emitRaffleLostTx(ctx, tx, r, userID, events.RaffleLostNotDrawn, now); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		hasActive, err := s.repo.HasActiveReservationTx(ctx, tx, r.ProductID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if hasActive {
+			if err := s.repo.SetEntryResultTx(ctx, tx, id, userID, EntryForfeited, nil); err != nil {
+				return nil, err
+			}
+			if err := s.emitRaffleLostTx(ctx, tx, r, userID, events.RaffleLostForfeited, now); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		level, err = s.productRepo.DecreaseStockTx(ctx, tx, r.ProductID, r.Quantity)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := s.repo.CreateTx(ctx, tx, r.ProductID, userID, r.Quantity, expiresAt, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.repo.SetEntryResultTx(ctx, tx, id, userID, EntryWon, &res.ID); err != nil {
+			return nil, err
+		}
+		if err := s.emitCreatedTx(ctx, tx, res, level.Stock); err != nil {
+			return nil, err
+		}
+		if err := s.emitRaffleWonTx(ctx, tx, r, res, now); err != nil {
+			return nil, err
+		}
+
+		winners = append(winners, *res)
+		soldOut = level.Stock < r.Quantity
+	}
+
+	if err := s.repo.MarkRestLostTx(ctx, tx, id); err != nil {
+		return nil, err
+	}
+	if err := s.repo.MarkRaffleDrawnTx(ctx, tx, id, len(winners), seed, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, res := range winners {
+		_ = s.redis.Set(ctx, TTLKey(res.ID), "active", time.Until(res.ExpiresAt)).Err()
+	}
+	if len(winners) > 0 {
+		_ = s.redis.IncrBy(ctx, "metrics:reservations:created", int64(len(winners))).Err()
+
+		// stock списан в обход Redis-фильтра — выставляем счётчик по БД
+		if s.gate != nil {
+			if err := s.gate.Set(ctx, r.ProductID, level.Stock); err != nil {
+				log.Printf("inventory gate set failed, product %d: %v", r.ProductID, err)
+			}
+		}
+		s.publishStock(ctx, level)
+	}
+
+	return s.GetRaffle(ctx, id)
+}
+
+// VerifyRaffle re-runs a finished draw from its seed and checks the
+// recorded results against it
+func (s *Service) VerifyRaffle(ctx context.Context, id int64) (*RaffleVerification, error) {
+	r, err := s.repo.GetRaffle(ctx, id)
+	if err != nil {
+		return nil, notFound(err, "raffle", id)
+	}
+	if r.Status != RaffleDrawn {
+		return nil, fmt.Errorf("%w: raffle is not drawn yet", ErrInvalidTransition)
+	}
+
+	entries, err := s.repo.ListRaffleEntries(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyRaffle(r, entries)
+}
+
+// revealSeed derives the seed of r from the secret and its nonce. The seed
+// must match the published hash — otherwise RAFFLE_SEED_SECRET has changed
+// since the raffle was created and it can't be drawn honestly.
+func (s *Service) revealSeed(r *Raffle) (string, error) {
+	if len(s.raffleSecret) == 0 {
+		return "", fmt.Errorf("%w: raffles need RAFFLE_SEED_SECRET", ErrUnavailable)
+	}
+
+	seed, hash := raffleSeed(s.raffleSecret, r.SeedNonce)
+	if hash != r.SeedHash {
+		return "", fmt.Errorf("raffle %d: derived seed does not match seed_hash, RAFFLE_SEED_SECRET has changed", r.ID)
+	}
+	return seed, nil
+}
+
+func entrantIDs(entries []RaffleEntry) []int64 {
+	ids := make([]int64, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.UserID)
+	}
+	return ids
+}
+
+// checkNoRaffleTx rejects direct holds of a product with an open raffle
+func (s *Service) checkNoRaffleTx(ctx context.Context, tx *sql.Tx, productID int64) error {
+	open, err := s.repo.HasOpenRaffleTx(ctx, tx, productID)
+	if err != nil {
+		return err
+	}
+	if open {
+		return ErrRaffleOnly
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package reservation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"testing"
+)
+
+var testRaffleSecret = []byte("raffle-secret")
+
+func TestRaffleSeed(t *testing.T) {
+	seed, hash := raffleSeed(testRaffleSecret, "nonce-1")
+
+	if again, _ := raffleSeed(testRaffleSecret, "nonce-1"); again != seed {
+		t.Errorf("same secret and nonce gave %s and %s", seed, again)
+	}
+
+	b, err := hex.DecodeString(seed)
+	if err != nil || len(b) != 32 {
+		t.Fatalf("seed %q is not 32 bytes hex", seed)
+	}
+	if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != hash {
+		t.Errorf("hash %s is not SHA-256 of the seed", hash)
+	}
+
+	tests := []struct {
+		name   string
+		secret []byte
+		nonce  string
+	}{
+		{"other nonce", testRaffleSecret, "nonce-2"},
+		{"other secret", []byte("other-secret"), "nonce-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if other, _ := raffleSeed(tt.secret, tt.nonce); other == seed {
+				t.Errorf("got the same seed %s", seed)
+			}
+		})
+	}
+}
+
+func TestDrawOrder(t *testing.T) {
+	seedA, _ := raffleSeed(testRaffleSecret, "a")
+	seedB, _ := raffleSeed(testRaffleSecret, "b")
+
+	entrants := make([]int64, 20)
+	for i := range entrants {
+		entrants[i] = int64(i + 1)
+	}
+	reversed := slices.Clone(entrants)
+	slices.Reverse(reversed)
+
+	want, err := DrawOrder(seedA, entrants)
+	if err != nil {
+		t.Fatalf("DrawOrder: %v", err)
+	}
+	if sorted := slices.Sorted(slices.Values(want)); !slices.Equal(sorted, entrants) {
+		t.Fatalf("order %v is not a permutation of the entrants", want)
+	}
+
+	tests := []struct {
+		name     string
+		seed     string
+		entrants []int64
+		same     bool
+	}{
+		{"same seed and entrants", seedA, entrants, true},
+		{"entrants in another order", seedA, reversed, true},
+		{"other seed", seedB, entrants, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DrawOrder(tt.seed, tt.entrants)
+			if err != nil {
+				t.Fatalf("DrawOrder: %v", err)
+			}
+			if slices.Equal(got, want) != tt.same {
+				t.Errorf("order %v, reference %v, want same = %v", got, want, tt.same)
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "zz", seedA[:62]} {
+		if _, err := DrawOrder(bad, entrants); err == nil {
+			t.Errorf("DrawOrder(%q) accepted a bad seed", bad)
+		}
+	}
+}
+
+func TestEntrantsHash(t *testing.T) {
+	want := EntrantsHash([]int64{1, 2, 3, 10})
+
+	tests := []struct {
+		name     string
+		entrants []int64
+		same     bool
+	}{
+		{"same order", []int64{1, 2, 3, 10}, true},
+		{"shuffled", []int64{10, 3, 1, 2}, true},
+		{"entrant dropped", []int64{1, 2, 3}, false},
+		{"entrant added", []int64{1, 2, 3, 10, 11}, false},
+		// разделитель между id: 1,2,3,10 и 1,2,31,0 — не одно и то же
+		{"digits regrouped", []int64{1, 2, 31, 0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EntrantsHash(tt.entrants); (got == want) != tt.same {
+				t.Errorf("EntrantsHash(%v) = %s, reference %s, want same = %v", tt.entrants, got, want, tt.same)
+			}
+		})
+	}
+}
+
+// drawnRaffle is a raffle of entrants drawn honestly with winners prizes
+func drawnRaffle(t *testing.T, entrants []int64, winners int) (*Raffle, []RaffleEntry) {
+	t.Helper()
+
+	seed, hash := raffleSeed(testRaffleSecret, "nonce")
+	order, err := DrawOrder(seed, entrants)
+	if err != nil {
+		t.Fatalf("DrawOrder: %v", err)
+	}
+
+	entries := make([]RaffleEntry, 0, len(order))
+	for i, userID := range order {
+		result := EntryLost
+		if i < winners {
+			result = EntryWon
+		}
+		entries = append(entries, RaffleEntry{RaffleID: 1, UserID: userID, Result: &result})
+	}
+
+	entrantsHash := EntrantsHash(entrants)
+	return &Raffle{
+		ID:           1,
+		Status:       RaffleDrawn,
+		Seed:         seed,
+		SeedHash:     hash,
+		EntrantsHash: &entrantsHash,
+		Winners:      &winners,
+	}, entries
+}
+
+func TestVerifyRaffle(t *testing.T) {
+	entrants := []int64{11, 12, 13, 14, 15, 16}
+
+	tests := []struct {
+		name   string
+		tamper func(r *Raffle, entries []RaffleEntry) []RaffleEntry
+		valid  bool
+	}{
+		{
+			name:   "honest draw",
+			tamper: func(_ *Raffle, entries []RaffleEntry) []RaffleEntry { return entries },
+			valid:  true,
+		},
+		{
+			name: "seed replaced",
+			tamper: func(r *Raffle, entries []RaffleEntry) []RaffleEntry {
+				r.Seed, _ = raffleSeed(testRaffleSecret, "other")
+				return entries
+			},
+		},
+		{
+			name: "seed and hash replaced",
+			tamper: func(r *Raffle, entries []RaffleEntry) []RaffleEntry {
+				r.Seed, r.SeedHash = raffleSeed(testRaffleSecret, "other")
+				return entries
+			},
+		},
+		{
+			name: "entrant dropped",
+			tamper: func(_ *Raffle, entries []RaffleEntry) []RaffleEntry {
+				return entries[1:]
+			},
+		},
+		{
+			name: "entrant added",
+			tamper: func(_ *Raffle, entries []RaffleEntry) []RaffleEntry {
+				lost := EntryLost
+				return append(entries, RaffleEntry{RaffleID: 1, UserID: 99, Result: &lost})
+			},
+		},
+		{
+			name: "winner swapped with a loser",
+			tamper: func(_ *Raffle, entries []RaffleEntry) []RaffleEntry {
+				entries[0].Result, entries[len(entries)-1].Result = entries[len(entries)-1].Result, entries[0].Result
+				return entries
+			},
+		},
+		{
+			name: "winners count changed",
+			tamper: func(r *Raffle, entries []RaffleEntry) []RaffleEntry {
+				n := *r.Winners + 1
+				r.Winners = &n
+				return entries
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, entries := drawnRaffle(t, entrants, 2)
+			entries = tt.tamper(r, entries)
+
+			v, err := verifyRaffle(r, entries)
+			if err != nil {
+				t.Fatalf("verifyRaffle: %v", err)
+			}
+			if v.Valid != tt.valid {
+				t.Errorf("valid = %v, want %v (problems: %v)", v.Valid, tt.valid, v.Problems)
+			}
+		})
+	}
+}
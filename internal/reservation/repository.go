@@ -3,6 +3,7 @@ package reservation
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 )
 
@@ -14,40 +15,73 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// reservationColumns is the column list every reservation query selects,
+// in the order scanReservation reads it
+const reservationColumns = `
+	id, product_id, user_id, quantity, status, expires_at, created_at,
+	cart_id, extensions, cancel_reason, canceled_by
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanReservation(row rowScanner) (*Reservation, error) {
+	var res Reservation
+	if err := row.Scan(
+		&res.ID,
+		&res.ProductID,
+		&res.UserID,
+		&res.Quantity,
+		&res.Status,
+		&res.ExpiresAt,
+		&res.CreatedAt,
+		&res.CartID,
+		&res.Extensions,
+		&res.CancelReason,
+		&res.CanceledBy,
+	); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func scanReservations(rows *sql.Rows) ([]Reservation, error) {
+	var result []Reservation
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *res)
+	}
+
+	return result, rows.Err()
+}
+
 // Create creates ACTIVE reservation
 func (r *Repository) Create(
 	ctx context.Context,
 	productID int64,
 	userID int64,
+	quantity int,
 	expiresAt time.Time,
 ) (*Reservation, error) {
 
 	query := `
-		INSERT INTO reservations (product_id, user_id, status, expires_at)
-		VALUES ($1, $2, 'ACTIVE', $3)
-		RETURNING id, product_id, user_id, status, expires_at, created_at
-	`
+		INSERT INTO reservations (product_id, user_id, quantity, status, expires_at)
+		VALUES ($1, $2, $3, 'ACTIVE', $4)
+		RETURNING ` + reservationColumns
 
-	var res Reservation
-	err := r.db.QueryRowContext(
+	return scanReservation(r.db.QueryRowContext(
 		ctx,
 		query,
 		productID,
 		userID,
+		quantity,
 		expiresAt,
-	).Scan(
-		&res.ID,
-		&res.ProductID,
-		&res.UserID,
-		&res.Status,
-		&res.ExpiresAt,
-		&res.CreatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return &res, nil
+	))
 }
 
 // GetByID returns reservation by id
@@ -57,43 +91,97 @@ func (r *Repository) GetByID(
 ) (*Reservation, error) {
 
 	query := `
-		SELECT id, product_id, user_id, status, expires_at, created_at
+		SELECT ` + reservationColumns + `
 		FROM reservations
 		WHERE id = $1
 	`
 
-	var res Reservation
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&res.ID,
-		&res.ProductID,
-		&res.UserID,
-		&res.Status,
-		&res.ExpiresAt,
-		&res.CreatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return &res, nil
+	return scanReservation(r.db.QueryRowContext(ctx, query, id))
 }
 
-// UpdateStatus updates reservation status
+// UpdateStatusTx moves a reservation from one status to another and
+// records the change in reservation_status_history. The transition must be
+// allowed by Transitions; a reservation that is no longer in from is left
+// alone and reported as ErrInvalidTransition.
 func (r *Repository) UpdateStatusTx(
 	ctx context.Context,
 	tx *sql.Tx,
 	id int64,
-	status string,
+	from, to string,
+	change StatusChange,
 ) error {
 
-	query := `
+	if err := Transitions.Check(from, to); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, updateStatusQuery, []int64{id}, from, to, change.Actor, change.Reason, change.At)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: reservation %d is no longer %s", ErrInvalidTransition, id, from)
+	}
+
+	return nil
+}
+
+// updateStatusQuery changes status only where it is still $2 and writes a
+// history row per changed reservation; a cancel also stores who and why
+const updateStatusQuery = `
+	WITH updated AS (
 		UPDATE reservations
-		SET status = $1
-		WHERE id = $2
+		SET status = $3,
+		    cancel_reason = CASE WHEN $3 = 'CANCELED' THEN NULLIF($5, '') ELSE cancel_reason END,
+		    canceled_by = CASE WHEN $3 = 'CANCELED' THEN $4 ELSE canceled_by END
+		WHERE id = ANY($1)
+		  AND status = $2
+		RETURNING id
+	)
+	INSERT INTO reservation_status_history (reservation_id, from_status, to_status, actor, reason, created_at)
+	SELECT id, $2, $3, $4, NULLIF($5, ''), $6
+	FROM updated
+`
+
+// GetStatusHistory returns the transitions of a reservation, oldest first
+func (r *Repository) GetStatusHistory(ctx context.Context, id int64) ([]StatusHistoryEntry, error) {
+
+	query := `
+		SELECT id, reservation_id, from_status, to_status, actor, reason, created_at
+		FROM reservation_status_history
+		WHERE reservation_id = $1
+		ORDER BY id
 	`
 
-	_, err := tx.ExecContext(ctx, query, status, id)
-	return err
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]StatusHistoryEntry, 0)
+	for rows.Next() {
+		var h StatusHistoryEntry
+		if err := rows.Scan(
+			&h.ID,
+			&h.ReservationID,
+			&h.From,
+			&h.To,
+			&h.Actor,
+			&h.Reason,
+			&h.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+
+	return history, rows.Err()
 }
 
 // List returns reservations with filters and pagination
@@ -106,7 +194,7 @@ func (r *Repository) List(
 ) ([]Reservation, error) {
 
 	query := `
-		SELECT id, product_id, user_id, status, expires_at, created_at
+		SELECT ` + reservationColumns + `
 		FROM reservations
 		WHERE ($1::bigint IS NULL OR user_id = $1)
 		  AND ($2::text IS NULL OR status = $2)
@@ -127,23 +215,7 @@ func (r *Repository) List(
 	}
 	defer rows.Close()
 
-	var result []Reservation
-	for rows.Next() {
-		var res Reservation
-		if err := rows.Scan(
-			&res.ID,
-			&res.ProductID,
-			&res.UserID,
-			&res.Status,
-			&res.ExpiresAt,
-			&res.CreatedAt,
-		); err != nil {
-			return nil, err
-		}
-		result = append(result, res)
-	}
-
-	return result, nil
+	return scanReservations(rows)
 }
 
 func (r *Repository) HasActiveReservationTx(
@@ -167,36 +239,124 @@ func (r *Repository) HasActiveReservationTx(
 	return exists, err
 }
 
+// LockUserLimitTx serializes limit checks of one user on one product or
+// campaign until the transaction ends
+func (r *Repository) LockUserLimitTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	scope string,
+	userID, id int64,
+) error {
+
+	key := fmt.Sprintf("limit:%s:%d:%d", scope, userID, id)
+
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, key)
+	return err
+}
+
+// TryLockUserLimitTx is LockUserLimitTx that gives up instead of waiting
+func (r *Repository) TryLockUserLimitTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	scope string,
+	userID, id int64,
+) (bool, error) {
+
+	key := fmt.Sprintf("limit:%s:%d:%d", scope, userID, id)
+
+	var locked bool
+	err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock(hashtextextended($1, 0))`, key).Scan(&locked)
+	return locked, err
+}
+
+// HeldInProductTx returns units of the product the user holds or has bought
+func (r *Repository) HeldInProductTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	userID, productID int64,
+) (int, error) {
+
+	query := `
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM reservations
+		WHERE user_id = $1
+		  AND product_id = $2
+		  AND status IN ('ACTIVE', 'CONFIRMED')
+	`
+
+	var held int
+	err := tx.QueryRowContext(ctx, query, userID, productID).Scan(&held)
+	return held, err
+}
+
+// HeldInCampaignTx returns units across all campaign products the user
+// holds or has bought
+func (r *Repository) HeldInCampaignTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	userID, campaignID int64,
+) (int, error) {
+
+	query := `
+		SELECT COALESCE(SUM(r.quantity), 0)
+		FROM reservations r
+		JOIN products p ON p.id = r.product_id
+		WHERE r.user_id = $1
+		  AND p.campaign_id = $2
+		  AND r.status IN ('ACTIVE', 'CONFIRMED')
+	`
+
+	var held int
+	err := tx.QueryRowContext(ctx, query, userID, campaignID).Scan(&held)
+	return held, err
+}
+
 func (r *Repository) CreateTx(
 	ctx context.Context,
 	tx *sql.Tx,
 	productID, userID int64,
+	quantity int,
 	expiresAt time.Time,
+	cartID *int64,
 ) (*Reservation, error) {
 
 	query := `
-		INSERT INTO reservations (product_id, user_id, status, expires_at)
-		VALUES ($1, $2, 'ACTIVE', $3)
-		RETURNING id, product_id, user_id, status, expires_at, created_at
-	`
+		INSERT INTO reservations (product_id, user_id, quantity, status, expires_at, cart_id)
+		VALUES ($1, $2, $3, 'ACTIVE', $4, $5)
+		RETURNING ` + reservationColumns
 
-	var res Reservation
-	err := tx.QueryRowContext(
+	res, err := scanReservation(tx.QueryRowContext(
 		ctx,
 		query,
 		productID,
 		userID,
+		quantity,
 		expiresAt,
-	).Scan(
-		&res.ID,
-		&res.ProductID,
-		&res.UserID,
-		&res.Status,
-		&res.ExpiresAt,
-		&res.CreatedAt,
-	)
+		cartID,
+	))
+	// параллельный резерв того же товара тем же пользователем
+	if isViolation(err, pgUniqueViolation, "ux_active_reservation") {
+		return nil, ErrAlreadyReserved
+	}
+	return res, err
+}
+
+// ExtendTx moves expires_at and counts the extension
+func (r *Repository) ExtendTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+	expiresAt time.Time,
+) (*Reservation, error) {
+
+	query := `
+		UPDATE reservations
+		SET expires_at = $1,
+		    extensions = extensions + 1
+		WHERE id = $2
+		RETURNING ` + reservationColumns
 
-	return &res, err
+	return scanReservation(tx.QueryRowContext(ctx, query, expiresAt, id))
 }
 
 func (r *Repository) GetByIDForUpdate(
@@ -206,63 +366,244 @@ func (r *Repository) GetByIDForUpdate(
 ) (*Reservation, error) {
 
 	query := `
-		SELECT id, product_id, user_id, status, expires_at, created_at
+		SELECT ` + reservationColumns + `
 		FROM reservations
 		WHERE id = $1
 		FOR UPDATE
 	`
 
-	var res Reservation
-	err := tx.QueryRowContext(ctx, query, id).Scan(
-		&res.ID,
-		&res.ProductID,
-		&res.UserID,
-		&res.Status,
-		&res.ExpiresAt,
-		&res.CreatedAt,
-	)
+	return scanReservation(tx.QueryRowContext(ctx, query, id))
+}
+
+// GetExpiredBatchForUpdate locks up to limit overdue ACTIVE reservations
+// together with the other ACTIVE lines of their carts, so a cart expires
+// as a unit and the batch may come back longer than limit. Rows already
+// locked by another sweeper or by checkout are skipped, and so is a cart
+// with any line skipped: it is left whole for the next sweep.
+func (r *Repository) GetExpiredBatchForUpdate(
+	ctx context.Context,
+	tx *sql.Tx,
+	now time.Time,
+	limit int,
+) ([]Reservation, error) {
+
+	query := `
+		WITH due AS (
+			SELECT id, cart_id
+			FROM reservations
+			WHERE status = 'ACTIVE'
+			  AND expires_at < $1
+			ORDER BY expires_at
+			LIMIT $2
+		),
+		locked AS (
+			SELECT ` + reservationColumns + `
+			FROM reservations
+			WHERE status = 'ACTIVE'
+			  AND (id IN (SELECT id FROM due)
+			       OR cart_id IN (SELECT cart_id FROM due))
+			FOR UPDATE SKIP LOCKED
+		)
+		SELECT ` + reservationColumns + `
+		FROM locked l
+		WHERE l.cart_id IS NULL
+		   OR (SELECT count(*) FROM locked x WHERE x.cart_id = l.cart_id)
+		    = (SELECT count(*) FROM reservations a WHERE a.cart_id = l.cart_id AND a.status = 'ACTIVE')
+		ORDER BY l.expires_at, l.id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, now, limit)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &res, nil
+	return scanReservations(rows)
 }
 
-func (r *Repository) GetExpiredForUpdate(
+// GetSaleEndedBatchForUpdate locks up to limit ACTIVE reservations of
+// products whose sale ended before now. Locked rows are skipped. ends_at is
+// stored in UTC, so now is compared in UTC too.
+func (r *Repository) GetSaleEndedBatchForUpdate(
 	ctx context.Context,
 	tx *sql.Tx,
 	now time.Time,
+	limit int,
 ) ([]Reservation, error) {
 
 	query := `
-		SELECT id, product_id, user_id, status, expires_at, created_at
+		SELECT ` + reservationColumns + `
 		FROM reservations
 		WHERE status = 'ACTIVE'
-		  AND expires_at < $1
-		FOR UPDATE
+		  AND product_id IN (
+			SELECT id
+			FROM products
+			WHERE ends_at <= $1
+		  )
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
 	`
 
-	rows, err := tx.QueryContext(ctx, query, now)
+	rows, err := tx.QueryContext(ctx, query, now.UTC(), limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var result []Reservation
+	return scanReservations(rows)
+}
+
+// UpdateStatusBatchTx is UpdateStatusTx for several reservations in one
+// statement; all of them must still be in from
+func (r *Repository) UpdateStatusBatchTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	ids []int64,
+	from, to string,
+	change StatusChange,
+) error {
+
+	if err := Transitions.Check(from, to); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, updateStatusQuery, ids, from, to, change.Actor, change.Reason, change.At)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != int64(len(ids)) {
+		return fmt.Errorf("%w: %d of %d reservations are no longer %s", ErrInvalidTransition, int64(len(ids))-n, len(ids), from)
+	}
+
+	return nil
+}
+
+// ListActive returns all ACTIVE reservations (for reconciliation)
+func (r *Repository) ListActive(ctx context.Context) ([]Reservation, error) {
+
+	query := `
+		SELECT ` + reservationColumns + `
+		FROM reservations
+		WHERE status = 'ACTIVE'
+		ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanReservations(rows)
+}
+
+// GetStatuses returns status by id; unknown ids are absent from the map
+func (r *Repository) GetStatuses(
+	ctx context.Context,
+	ids []int64,
+) (map[int64]string, error) {
+
+	query := `
+		SELECT id, status
+		FROM reservations
+		WHERE id = ANY($1)
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64]string, len(ids))
 	for rows.Next() {
-		var res Reservation
-		if err := rows.Scan(
-			&res.ID,
-			&res.ProductID,
-			&res.UserID,
-			&res.Status,
-			&res.ExpiresAt,
-			&res.CreatedAt,
-		); err != nil {
+		var (
+			id     int64
+			status string
+		)
+		if err := rows.Scan(&id, &status); err != nil {
 			return nil, err
 		}
-		result = append(result, res)
+		result[id] = status
+	}
+
+	return result, rows.Err()
+}
+
+// GetCartStatuses returns the status of each cart by id, derived from its
+// lines like Cart.Status; unknown ids are absent from the map
+func (r *Repository) GetCartStatuses(
+	ctx context.Context,
+	ids []int64,
+) (map[int64]string, error) {
+
+	query := `
+		SELECT cart_id, status
+		FROM reservations
+		WHERE cart_id = ANY($1)
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make(map[int64][]Reservation, len(ids))
+	for rows.Next() {
+		var (
+			id     int64
+			status string
+		)
+		if err := rows.Scan(&id, &status); err != nil {
+			return nil, err
+		}
+		lines[id] = append(lines[id], Reservation{Status: status})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]string, len(lines))
+	for id, l := range lines {
+		result[id] = cartStatus(l)
 	}
 
 	return result, nil
 }
+
+// CountByStatus returns number of reservations per status
+func (r *Repository) CountByStatus(ctx context.Context) (map[string]int64, error) {
+
+	query := `
+		SELECT status, count(*)
+		FROM reservations
+		GROUP BY status
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]int64)
+	for rows.Next() {
+		var (
+			status string
+			count  int64
+		)
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		result[status] = count
+	}
+
+	return result, rows.Err()
+}
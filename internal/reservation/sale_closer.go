@@ -0,0 +1,72 @@
+package reservation
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// SaleCloser periodically releases holds left on products whose sale has
+// ended: they are canceled and their stock goes back to the product. It
+// also closes raffles whose registration is over (see CloseRaffle).
+type SaleCloser struct {
+	service   *Service
+	interval  time.Duration
+	batchSize int
+}
+
+func NewSaleCloser(service *Service, interval time.Duration, batchSize int) *SaleCloser {
+	return &SaleCloser{
+		service:   service,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run closes once immediately and then on every tick until ctx is canceled.
+func (c *SaleCloser) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	log.Printf("sale closer started, interval=%s batch=%d", c.interval, c.batchSize)
+
+	c.close(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("sale closer stopped")
+			return
+		case <-ticker.C:
+			c.close(ctx)
+		}
+	}
+}
+
+func (c *SaleCloser) close(ctx context.Context) {
+	count, err := c.service.ReleaseEndedSales(ctx, c.batchSize)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("sale close failed: %v", err)
+		return
+	}
+
+	// пустые проходы не логируем: распродажи заканчиваются редко
+	if count > 0 {
+		log.Printf("sale close done: released=%d", count)
+	}
+
+	closed, err := c.service.CloseEndedRaffles(ctx, c.batchSize)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("raffle close failed: %v", err)
+		return
+	}
+	if closed > 0 {
+		log.Printf("raffle close done: closed=%d", closed)
+	}
+}
@@ -2,26 +2,45 @@ package reservation
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"flash-sale-reservation/internal/events"
+	"flash-sale-reservation/internal/inventory"
 	"flash-sale-reservation/internal/outbox"
 	"flash-sale-reservation/internal/product"
+	"flash-sale-reservation/internal/queue"
+	"flash-sale-reservation/internal/stock"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"log"
+	"slices"
 	"time"
 )
 
-const (
-	StatusActive    = "ACTIVE"
-	StatusConfirmed = "CONFIRMED"
-	StatusCanceled  = "CANCELED"
-	StatusExpired   = "EXPIRED"
-)
+// DefaultHoldDuration is how long a reservation holds stock when neither
+// the product nor HOLD_DURATION says otherwise
+const DefaultHoldDuration = 5 * time.Minute
+
+// MaxQuantity caps units held by a single reservation
+const MaxQuantity = 100
+
+// DefaultExpireBatchSize limits how many reservations one expiry transaction locks
+const DefaultExpireBatchSize = 500
 
 type Service struct {
 	repo        *Repository
 	productRepo *product.Repository
 	outboxRepo  *outbox.Repository
 	redis       *redis.Client
+	stockFeed   *stock.Feed
+	// gate == nil — Redis-фильтр stock выключен
+	gate *inventory.Gate
+	// room — очередь для товаров с queued = true
+	room *queue.Room
+	// defaultHold — длительность резерва для товаров без hold_seconds
+	defaultHold time.Duration
+	// raffleSecret — из него выводятся seed розыгрышей; пусто — розыгрыши не создаются
+	raffleSecret []byte
 }
 
 func NewService(
@@ -29,71 +48,189 @@ func NewService(
 	productRepo *product.Repository,
 	outboxRepo *outbox.Repository,
 	redis *redis.Client,
+	stockFeed *stock.Feed,
+	gate *inventory.Gate,
+	room *queue.Room,
+	defaultHold time.Duration,
+	raffleSecret []byte,
 ) *Service {
+	if defaultHold <= 0 {
+		defaultHold = DefaultHoldDuration
+	}
+
 	return &Service{
-		repo:        repo,
-		productRepo: productRepo,
-		outboxRepo:  outboxRepo,
-		redis:       redis,
+		repo:         repo,
+		productRepo:  productRepo,
+		outboxRepo:   outboxRepo,
+		redis:        redis,
+		stockFeed:    stockFeed,
+		gate:         gate,
+		room:         room,
+		defaultHold:  defaultHold,
+		raffleSecret: raffleSecret,
 	}
 }
 
-// Create reservation (15 min hold)
+// Create reservation of quantity units, held for the product's hold duration.
+// queueToken is required for queued products: it is claimed before the
+// insert, so it can't be used twice, and consumed on success.
 func (s *Service) Create(
 	ctx context.Context,
 	productID int64,
 	userID int64,
+	quantity int,
+	queueToken string,
 ) (*Reservation, error) {
 
-	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if quantity <= 0 || quantity > MaxQuantity {
+		return nil, fmt.Errorf("%w: quantity must be between 1 and %d", ErrInvalidInput, MaxQuantity)
+	}
+
+	// 0. Redis-фильтр: распроданный товар отсекаем, не трогая БД
+	gated, err := s.gateReserve(ctx, productID, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	res, level, err := s.createTx(ctx, productID, userID, quantity, queueToken)
 	if err != nil {
+		// компенсация: единицы в БД не списаны
+		if gated {
+			s.gateRelease(ctx, productID, quantity)
+		}
 		return nil, err
 	}
+
+	// 8. Redis TTL
+	key := TTLKey(res.ID)
+	ttl := time.Until(res.ExpiresAt)
+	_ = s.redis.Set(ctx, key, "active", ttl).Err()
+
+	// 9. Redis metric
+	_ = s.redis.Incr(ctx, "metrics:reservations:created").Err()
+
+	// 10. Live stock
+	s.publishStock(ctx, level)
+
+	// 11. Токен очереди одноразовый; повторно его уже не пустит claim,
+	// здесь удаляются ключи
+	if queueToken != "" && s.room != nil {
+		if err := s.room.Consume(ctx, queueToken, productID, userID); err != nil {
+			log.Printf("queue token consume failed, product %d: %v", productID, err)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Service) createTx(
+	ctx context.Context,
+	productID int64,
+	userID int64,
+	quantity int,
+	queueToken string,
+) (res *Reservation, level product.StockLevel, err error) {
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, product.StockLevel{}, err
+	}
 	defer tx.Rollback()
 
 	// 1. Проверка активного резерва
 	hasActive, err := s.repo.HasActiveReservationTx(ctx, tx, productID, userID)
 	if err != nil {
-		return nil, err
+		return nil, product.StockLevel{}, err
 	}
 	if hasActive {
-		return nil, errors.New("active reservation already exists")
+		return nil, product.StockLevel{}, ErrAlreadyReserved
 	}
 
-	// 2. Уменьшаем stock продукта
-	if err := s.productRepo.DecreaseStockTx(ctx, tx, productID); err != nil {
-		return nil, err
+	// 2. Окно распродажи
+	p, err := s.productRepo.GetByIDTx(ctx, tx, productID)
+	if err != nil {
+		return nil, product.StockLevel{}, notFound(err, "product", productID)
 	}
 
-	// 3. Создаём резерв на 5 минут
-	expiresAt := time.Now().Add(5 * time.Minute)
+	now := time.Now()
+	if err := p.CheckSaleWindow(now); err != nil {
+		return nil, product.StockLevel{}, err
+	}
 
-	res, err := s.repo.CreateTx(ctx, tx, productID, userID, expiresAt)
+	// Розыгрыш: пока он открыт, товар не резервируется напрямую
+	if err := s.checkNoRaffleTx(ctx, tx, productID); err != nil {
+		return nil, product.StockLevel{}, err
+	}
+
+	// Очередь: только пропущенный токен этого пользователя; забираем его
+	// до вставки, а если резерв не создан — возвращаем
+	if p.Queued {
+		if err := s.claimAdmission(ctx, queueToken, productID, userID); err != nil {
+			return nil, product.StockLevel{}, err
+		}
+		defer func() {
+			if err != nil {
+				s.unclaimAdmission(ctx, queueToken, productID)
+			}
+		}()
+	}
+
+	// 3. Лимиты на пользователя по товару и кампании
+	items := []CartItem{{ProductID: productID, Quantity: quantity}}
+	if err := s.checkLimitsTx(ctx, tx, userID, items, map[int64]*product.Product{productID: p}, true); err != nil {
+		return nil, product.StockLevel{}, err
+	}
+
+	// 4. Уменьшаем stock продукта сразу на quantity — всё или ничего
+	level, err = s.productRepo.DecreaseStockTx(ctx, tx, productID, quantity)
 	if err != nil {
-		return nil, err
+		return nil, product.StockLevel{}, err
 	}
 
-	// 4. Commit
-	if err := tx.Commit(); err != nil {
-		return nil, err
+	// 5. Создаём резерв на время удержания товара
+	expiresAt := now.Add(p.InitialHold(s.defaultHold))
+
+	res, err = s.repo.CreateTx(ctx, tx, productID, userID, quantity, expiresAt, nil)
+	if err != nil {
+		return nil, product.StockLevel{}, err
 	}
 
-	// 5. Redis TTL
-	key := fmt.Sprintf("reservation:%d", res.ID)
-	ttl := time.Until(res.ExpiresAt)
-	_ = s.redis.Set(ctx, key, "active", ttl).Err()
+	// 6. Outbox: ReservationCreated + StockChanged
+	if err := s.emitCreatedTx(ctx, tx, res, level.Stock); err != nil {
+		return nil, product.StockLevel{}, err
+	}
 
-	// 6. Redis metric
-	_ = s.redis.Incr(ctx, "metrics:reservations:created").Err()
+	// 7. Commit
+	if err := tx.Commit(); err != nil {
+		return nil, product.StockLevel{}, err
+	}
+
+	return res, level, nil
+}
 
+// GetByID returns a reservation of userID
+func (s *Service) GetByID(ctx context.Context, id, userID int64) (*Reservation, error) {
+	res, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, notFound(err, "reservation", id)
+	}
+	if err := checkOwnedBy(res.UserID, userID); err != nil {
+		return nil, err
+	}
 	return res, nil
 }
 
-func (s *Service) GetByID(ctx context.Context, id int64) (*Reservation, error) {
-	return s.repo.GetByID(ctx, id)
+// History returns the status transitions of a reservation of userID,
+// oldest first
+func (s *Service) History(ctx context.Context, id, userID int64) ([]StatusHistoryEntry, error) {
+	if _, err := s.GetByID(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetStatusHistory(ctx, id)
 }
 
-func (s *Service) Confirm(ctx context.Context, id int64) error {
+// Confirm closes an ACTIVE hold of userID as bought
+func (s *Service) Confirm(ctx context.Context, id, userID int64) error {
 
 	tx, err := s.repo.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -103,32 +240,29 @@ func (s *Service) Confirm(ctx context.Context, id int64) error {
 
 	res, err := s.repo.GetByIDForUpdate(ctx, tx, id)
 	if err != nil {
-		return err
+		return notFound(err, "reservation", id)
 	}
 
-	if res.Status != StatusActive {
-		return errors.New("only ACTIVE reservation can be confirmed")
+	if err := checkOwnedBy(res.UserID, userID); err != nil {
+		return err
+	}
+	if res.CartID != nil {
+		return fmt.Errorf("%w: reservation belongs to cart %d, confirm the cart", ErrInvalidTransition, *res.CartID)
 	}
 
-	// 1. Обновляем статус
-	if err := s.repo.UpdateStatusTx(ctx, tx, id, StatusConfirmed); err != nil {
+	// истёкший, но ещё не обработанный резерв подтвердить уже нельзя
+	now := time.Now()
+	if err := checkNotExpired(res, now); err != nil {
 		return err
 	}
 
-	// 2. Пишем событие в outbox
-	eventPayload := map[string]any{
-		"reservation_id": res.ID,
-		"product_id":     res.ProductID,
-		"user_id":        res.UserID,
-		"confirmed_at":   time.Now(),
+	// 1. Обновляем статус (переход проверяется по Transitions, пишется история)
+	if err := s.repo.UpdateStatusTx(ctx, tx, id, res.Status, StatusConfirmed, StatusChange{Actor: ActorUser, At: now}); err != nil {
+		return err
 	}
 
-	if err := s.outboxRepo.InsertTx(
-		ctx,
-		tx,
-		"ReservationConfirmed",
-		eventPayload,
-	); err != nil {
+	// 2. Пишем событие в outbox
+	if err := s.emitConfirmedTx(ctx, tx, res, now); err != nil {
 		return err
 	}
 
@@ -137,13 +271,21 @@ func (s *Service) Confirm(ctx context.Context, id int64) error {
 		return err
 	}
 
+	s.dropTTL(ctx, res.ID)
+
 	// Redis metric
 	_ = s.redis.Incr(ctx, "metrics:reservations:confirmed").Err()
 
 	return nil
 }
 
-func (s *Service) Cancel(ctx context.Context, id int64) error {
+// Cancel returns the stock of an ACTIVE reservation. A user may cancel
+// only their own reservation; the reason is checked against c.Actor.
+func (s *Service) Cancel(ctx context.Context, id int64, c Cancellation) error {
+
+	if err := c.normalize(); err != nil {
+		return err
+	}
 
 	tx, err := s.repo.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -153,19 +295,45 @@ func (s *Service) Cancel(ctx context.Context, id int64) error {
 
 	res, err := s.repo.GetByIDForUpdate(ctx, tx, id)
 	if err != nil {
+		return notFound(err, "reservation", id)
+	}
+
+	if err := c.checkOwner(res.UserID); err != nil {
 		return err
 	}
 
-	if res.Status != StatusActive {
-		return errors.New("only ACTIVE reservation can be canceled")
+	if res.CartID != nil {
+		return fmt.Errorf("%w: reservation belongs to cart %d, cancel the cart", ErrInvalidTransition, *res.CartID)
+	}
+
+	// истёкший, но ещё не обработанный резерв отменить можно: stock вернётся так же
+	if res.Status == StatusExpired {
+		return fmt.Errorf("%w: reservation %d", ErrExpired, id)
+	}
+	if err := Transitions.Check(res.Status, StatusCanceled); err != nil {
+		return err
 	}
 
 	// Возвращаем stock
-	if err := s.productRepo.IncreaseStockTx(ctx, tx, res.ProductID); err != nil {
+	level, err := s.productRepo.IncreaseStockTx(ctx, tx, res.ProductID, res.Quantity)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	change := c.statusChange()
+	change.At = now
+	if err := s.repo.UpdateStatusTx(ctx, tx, id, res.Status, StatusCanceled, change); err != nil {
 		return err
 	}
 
-	if err := s.repo.UpdateStatusTx(ctx, tx, id, StatusCanceled); err != nil {
+	if err := s.emitCanceledTx(ctx, tx, res, level.Stock, c, now); err != nil {
+		return err
+	}
+
+	// Возвращённый stock — очереди ожидания
+	promoted, level, err := s.promoteWaitlistTx(ctx, tx, level, now)
+	if err != nil {
 		return err
 	}
 
@@ -173,12 +341,157 @@ func (s *Service) Cancel(ctx context.Context, id int64) error {
 		return err
 	}
 
+	s.dropTTL(ctx, res.ID)
+
 	// Redis metric
-	_ = s.redis.Incr(ctx, "metrics:reservations:canceled").Err()
+	s.countCanceled(ctx, c.Reason, 1)
+
+	s.afterPromotion(ctx, res.ProductID, res.Quantity, promoted)
+	s.publishStock(ctx, level)
 
 	return nil
 }
 
+// Extend prolongs an ACTIVE hold by the product's hold duration. The number
+// of extensions and the total hold time are capped per product. Only the
+// owner, userID, may extend it.
+func (s *Service) Extend(ctx context.Context, id, userID int64) (*Reservation, error) {
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := s.repo.GetByIDForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, notFound(err, "reservation", id)
+	}
+
+	if err := checkOwnedBy(res.UserID, userID); err != nil {
+		return nil, err
+	}
+	if res.CartID != nil {
+		return nil, fmt.Errorf("%w: reservation belongs to cart %d and can't be extended", ErrInvalidTransition, *res.CartID)
+	}
+
+	now := time.Now()
+	if err := checkNotExpired(res, now); err != nil {
+		return nil, err
+	}
+	if Transitions.IsTerminal(res.Status) {
+		return nil, fmt.Errorf("%w: reservation is %s and can't be extended", ErrInvalidTransition, res.Status)
+	}
+
+	p, err := s.productRepo.GetByIDTx(ctx, tx, res.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Extensions >= p.MaxExtensions {
+		return nil, fmt.Errorf("%w: reservation can be extended at most %d times", ErrInvalidTransition, p.MaxExtensions)
+	}
+
+	expiresAt := res.ExpiresAt.Add(p.HoldDuration(s.defaultHold))
+	if maxHold := p.MaxHold(); maxHold > 0 {
+		limit := res.CreatedAt.Add(maxHold)
+		if !limit.After(res.ExpiresAt) {
+			return nil, fmt.Errorf("%w: reservation already held for the maximum of %s", ErrInvalidTransition, maxHold)
+		}
+		if expiresAt.After(limit) {
+			expiresAt = limit
+		}
+	}
+
+	previous := res.ExpiresAt
+	res, err = s.repo.ExtendTx(ctx, tx, id, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.emitExtendedTx(ctx, tx, res, previous, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Redis TTL: Set, а не PExpireAt — ключа к этому моменту может уже не быть
+	_ = s.redis.Set(ctx, TTLKey(res.ID), "active", time.Until(res.ExpiresAt)).Err()
+
+	_ = s.redis.Incr(ctx, "metrics:reservations:extended").Err()
+
+	return res, nil
+}
+
+// ExpireByID expires a single reservation if it is still ACTIVE and its
+// expires_at has passed according to the database. A cart line is expired
+// together with its cart, see ExpireCart.
+// Returns false when there was nothing to expire.
+func (s *Service) ExpireByID(ctx context.Context, id int64) (bool, error) {
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := s.repo.GetByIDForUpdate(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// строка корзины истекает только вместе с корзиной; блокировку отпускаем,
+	// чтобы ExpireCart взял строки в том же порядке, что и остальные операции
+	if res.CartID != nil {
+		_ = tx.Rollback()
+		return s.ExpireCart(ctx, *res.CartID)
+	}
+
+	// истина в БД: резерв уже закрыт или ещё не истёк
+	now := time.Now()
+	if !Transitions.Can(res.Status, StatusExpired) || res.ExpiresAt.After(now) {
+		return false, nil
+	}
+
+	level, err := s.productRepo.IncreaseStockTx(ctx, tx, res.ProductID, res.Quantity)
+	if err != nil {
+		return false, err
+	}
+
+	if err := s.repo.UpdateStatusTx(ctx, tx, id, res.Status, StatusExpired, StatusChange{Actor: ActorSystem, At: now}); err != nil {
+		return false, err
+	}
+
+	if err := s.emitExpiredTx(ctx, tx, res, now); err != nil {
+		return false, err
+	}
+	if err := s.emitStockChangedTx(ctx, tx, res.ProductID, res.Quantity, level.Stock, events.StockReasonExpired, &res.ID, now); err != nil {
+		return false, err
+	}
+
+	promoted, level, err := s.promoteWaitlistTx(ctx, tx, level, now)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	// Redis metric
+	_ = s.redis.Incr(ctx, "metrics:reservations:expired").Err()
+
+	s.afterPromotion(ctx, res.ProductID, res.Quantity, promoted)
+	s.publishStock(ctx, level)
+
+	return true, nil
+}
+
 func (s *Service) List(
 	ctx context.Context,
 	userID *int64,
@@ -188,13 +501,38 @@ func (s *Service) List(
 ) ([]Reservation, error) {
 
 	if limit <= 0 {
-		return nil, errors.New("limit must be > 0")
+		return nil, fmt.Errorf("%w: limit must be > 0", ErrInvalidInput)
 	}
 
 	return s.repo.List(ctx, userID, status, limit, offset)
 }
 
+// ExpireReservations expires all overdue reservations in batches of DefaultExpireBatchSize
 func (s *Service) ExpireReservations(ctx context.Context) (int, error) {
+	return s.ExpireReservationsBatched(ctx, DefaultExpireBatchSize)
+}
+
+// ExpireReservationsBatched expires overdue reservations batch by batch,
+// each batch in its own transaction, until a batch comes back short.
+func (s *Service) ExpireReservationsBatched(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultExpireBatchSize
+	}
+
+	total := 0
+	for {
+		n, err := s.expireBatch(ctx, batchSize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < batchSize {
+			return total, nil
+		}
+	}
+}
+
+func (s *Service) expireBatch(ctx context.Context, limit int) (int, error) {
 
 	tx, err := s.repo.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -204,20 +542,166 @@ func (s *Service) ExpireReservations(ctx context.Context) (int, error) {
 
 	now := time.Now()
 
-	reservations, err := s.repo.GetExpiredForUpdate(ctx, tx, now)
+	reservations, err := s.repo.GetExpiredBatchForUpdate(ctx, tx, now, limit)
 	if err != nil {
 		return 0, err
 	}
+	if len(reservations) == 0 {
+		return 0, nil
+	}
 
+	if err := s.expireLocked(ctx, tx, reservations, now); err != nil {
+		return 0, err
+	}
+
+	return len(reservations), nil
+}
+
+// expireLocked moves reservations locked by tx from ACTIVE to EXPIRED,
+// returns their stock, promotes the waitlist and commits tx. Lines of a
+// cart come in together with the rest of their cart.
+func (s *Service) expireLocked(ctx context.Context, tx *sql.Tx, reservations []Reservation, now time.Time) error {
+
+	ids := make([]int64, 0, len(reservations))
+	deltas := make(map[int64]int)
+	var single, carts []int64
 	for _, res := range reservations {
+		ids = append(ids, res.ID)
+		deltas[res.ProductID] += res.Quantity
+		if res.CartID == nil {
+			single = append(single, res.ID)
+		} else if !slices.Contains(carts, *res.CartID) {
+			carts = append(carts, *res.CartID)
+		}
+	}
+
+	// возвращаем stock одним UPDATE на товар
+	levels, err := s.productRepo.IncreaseStockBatchTx(ctx, tx, deltas)
+	if err != nil {
+		return err
+	}
+
+	// меняем статус
+	if err := s.repo.UpdateStatusBatchTx(ctx, tx, ids, StatusActive, StatusExpired, StatusChange{Actor: ActorSystem, At: now}); err != nil {
+		return err
+	}
+
+	// события: ReservationExpired на резерв, StockChanged на товар
+	for i := range reservations {
+		if err := s.emitExpiredTx(ctx, tx, &reservations[i], now); err != nil {
+			return err
+		}
+	}
+	productIDs := make([]int64, 0, len(deltas))
+	for productID := range deltas {
+		productIDs = append(productIDs, productID)
+	}
+	slices.Sort(productIDs)
+
+	promoted := make(map[int64][]Reservation)
+	for _, productID := range productIDs {
+		if err := s.emitStockChangedTx(ctx, tx, productID, deltas[productID], levels[productID].Stock, events.StockReasonExpired, nil, now); err != nil {
+			return err
+		}
+
+		// строки товаров уже заблокированы IncreaseStockBatchTx
+		promoted[productID], levels[productID], err = s.promoteWaitlistTx(ctx, tx, levels[productID], now)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// сборщик мог успеть раньше Redis: ключи больше не нужны
+	s.dropTTL(ctx, single...)
+	s.dropCartTTL(ctx, carts...)
+
+	// Redis metric
+	_ = s.redis.IncrBy(
+		ctx,
+		"metrics:reservations:expired",
+		int64(len(reservations)),
+	).Err()
+
+	for _, productID := range productIDs {
+		s.afterPromotion(ctx, productID, deltas[productID], promoted[productID])
+		s.publishStock(ctx, levels[productID])
+	}
+
+	return nil
+}
+
+// ReleaseEndedSales cancels ACTIVE reservations of products whose sale has
+// ended and returns their stock, batch by batch like expiry.
+func (s *Service) ReleaseEndedSales(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultExpireBatchSize
+	}
+
+	total := 0
+	for {
+		n, err := s.releaseEndedBatch(ctx, batchSize)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < batchSize {
+			return total, nil
+		}
+	}
+}
+
+func (s *Service) releaseEndedBatch(ctx context.Context, limit int) (int, error) {
 
-		// возвращаем stock
-		if err := s.productRepo.IncreaseStockTx(ctx, tx, res.ProductID); err != nil {
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	reservations, err := s.repo.GetSaleEndedBatchForUpdate(ctx, tx, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	if len(reservations) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int64, 0, len(reservations))
+	deltas := make(map[int64]int)
+	for _, res := range reservations {
+		ids = append(ids, res.ID)
+		deltas[res.ProductID] += res.Quantity
+	}
+
+	levels, err := s.productRepo.IncreaseStockBatchTx(ctx, tx, deltas)
+	if err != nil {
+		return 0, err
+	}
+
+	change := StatusChange{Actor: ActorSystem, Reason: CancelSaleEnded, At: now}
+	if err := s.repo.UpdateStatusBatchTx(ctx, tx, ids, StatusActive, StatusCanceled, change); err != nil {
+		return 0, err
+	}
+
+	for i := range reservations {
+		if err := s.emitSaleEndedTx(ctx, tx, &reservations[i], now); err != nil {
 			return 0, err
 		}
+	}
+	productIDs := make([]int64, 0, len(deltas))
+	for productID := range deltas {
+		productIDs = append(productIDs, productID)
+	}
+	slices.Sort(productIDs)
 
-		// меняем статус
-		if err := s.repo.UpdateStatusTx(ctx, tx, res.ID, StatusExpired); err != nil {
+	for _, productID := range productIDs {
+		if err := s.emitStockChangedTx(ctx, tx, productID, deltas[productID], levels[productID].Stock, events.StockReasonSaleEnded, nil, now); err != nil {
 			return 0, err
 		}
 	}
@@ -226,14 +710,139 @@ func (s *Service) ExpireReservations(ctx context.Context) (int, error) {
 		return 0, err
 	}
 
-	// Redis metric
-	if len(reservations) > 0 {
-		_ = s.redis.IncrBy(
-			ctx,
-			"metrics:reservations:expired",
-			int64(len(reservations)),
-		).Err()
+	s.dropTTL(ctx, ids...)
+	s.countCanceled(ctx, CancelSaleEnded, len(reservations))
+
+	for _, productID := range productIDs {
+		s.gateRelease(ctx, productID, deltas[productID])
+		s.publishStock(ctx, levels[productID])
 	}
 
 	return len(reservations), nil
 }
+
+// dropTTL deletes the reservation:{id} keys of holds that are no longer
+// ACTIVE, so they don't linger in Redis and don't wake the expiry listener
+func (s *Service) dropTTL(ctx context.Context, ids ...int64) {
+	if len(ids) == 0 {
+		return
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = TTLKey(id)
+	}
+	_ = s.redis.Del(ctx, keys...).Err()
+}
+
+// dropCartTTL deletes the cart:{id} keys of carts that have no ACTIVE line left
+func (s *Service) dropCartTTL(ctx context.Context, ids ...int64) {
+	if len(ids) == 0 {
+		return
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = CartTTLKey(id)
+	}
+	_ = s.redis.Del(ctx, keys...).Err()
+}
+
+// countCanceled counts canceled reservations in total and per reason
+func (s *Service) countCanceled(ctx context.Context, reason string, n int) {
+	_ = s.redis.IncrBy(ctx, "metrics:reservations:canceled", int64(n)).Err()
+	_ = s.redis.IncrBy(ctx, "metrics:reservations:canceled:"+reason, int64(n)).Err()
+}
+
+// checkNotExpired rejects a reservation that is EXPIRED or still open but
+// past its expires_at (the expirer just hasn't got to it yet)
+func checkNotExpired(res *Reservation, now time.Time) error {
+	if res.Status == StatusExpired || (!Transitions.IsTerminal(res.Status) && !res.ExpiresAt.After(now)) {
+		return fmt.Errorf("%w: reservation %d", ErrExpired, res.ID)
+	}
+	return nil
+}
+
+// claimAdmission lets a hold on a queued product through only with an
+// admitted token and takes the token for it. Unlike the inventory gate it
+// fails closed: without Redis there is no fair order to admit by.
+func (s *Service) claimAdmission(ctx context.Context, token string, productID, userID int64) error {
+	if s.room == nil {
+		return fmt.Errorf("%w: waiting room is not configured", ErrUnavailable)
+	}
+
+	err := s.room.Claim(ctx, token, productID, userID)
+	if err != nil && !isQueueRejection(err) {
+		return fmt.Errorf("%w: waiting room: %v", ErrUnavailable, err)
+	}
+
+	return err
+}
+
+// unclaimAdmission returns the token of a hold that wasn't created
+func (s *Service) unclaimAdmission(ctx context.Context, token string, productID int64) {
+	if err := s.room.Unclaim(ctx, token); err != nil {
+		log.Printf("queue token unclaim failed, product %d: %v", productID, err)
+	}
+}
+
+func isQueueRejection(err error) bool {
+	return errors.Is(err, queue.ErrTokenRequired) ||
+		errors.Is(err, queue.ErrTokenInvalid) ||
+		errors.Is(err, queue.ErrNotAdmitted) ||
+		errors.Is(err, queue.ErrTokenExpired) ||
+		errors.Is(err, queue.ErrTokenUsed)
+}
+
+// publishStock pushes a committed stock level to live subscribers (best effort)
+func (s *Service) publishStock(ctx context.Context, level product.StockLevel) {
+	if s.stockFeed == nil {
+		return
+	}
+	_ = s.stockFeed.Publish(ctx, level)
+}
+
+// gateReserve takes n units on the Redis gate. Returns true if they were
+// taken and must be released should the DB transaction fail. If Redis is
+// unavailable the request falls through to PostgreSQL.
+func (s *Service) gateReserve(ctx context.Context, productID int64, n int) (bool, error) {
+	if s.gate == nil {
+		return false, nil
+	}
+
+	err := s.gate.Reserve(ctx, productID, n)
+	if errors.Is(err, inventory.ErrSoldOut) {
+		return false, err
+	}
+	if err != nil {
+		log.Printf("inventory gate unavailable, product %d: %v", productID, err)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// gateAvailable is the gate's view of the stock: what Create would be
+// let through with. ok = false when the gate is off or unavailable.
+func (s *Service) gateAvailable(ctx context.Context, productID int64) (int, bool) {
+	if s.gate == nil {
+		return 0, false
+	}
+
+	n, err := s.gate.Available(ctx, productID)
+	if err != nil {
+		log.Printf("inventory gate unavailable, product %d: %v", productID, err)
+		return 0, false
+	}
+
+	return n, true
+}
+
+func (s *Service) gateRelease(ctx context.Context, productID int64, n int) {
+	if s.gate == nil {
+		return
+	}
+	if err := s.gate.Release(ctx, productID, n); err != nil {
+		log.Printf("inventory gate release failed, product %d: %v", productID, err)
+	}
+}
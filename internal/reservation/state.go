@@ -0,0 +1,71 @@
+package reservation
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	StatusActive    = "ACTIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCanceled  = "CANCELED"
+	StatusExpired   = "EXPIRED"
+)
+
+// Кто изменил статус резерва
+const (
+	ActorUser   = "user"
+	ActorAdmin  = "admin"
+	ActorSystem = "system"
+)
+
+// StateMachine maps a status to the statuses it may change to. A status
+// without outgoing transitions is terminal.
+type StateMachine map[string][]string
+
+// Transitions is the reservation lifecycle. A new status needs an entry
+// here and in the reservations_status_check constraint.
+var Transitions = StateMachine{
+	StatusActive:    {StatusConfirmed, StatusCanceled, StatusExpired},
+	StatusConfirmed: nil,
+	StatusCanceled:  nil,
+	StatusExpired:   nil,
+}
+
+// Can reports whether from may change to to
+func (m StateMachine) Can(from, to string) bool {
+	return slices.Contains(m[from], to)
+}
+
+// Check returns ErrInvalidTransition unless from may change to to
+func (m StateMachine) Check(from, to string) error {
+	if !m.Can(from, to) {
+		return fmt.Errorf("%w: reservation is %s and can't become %s", ErrInvalidTransition, from, to)
+	}
+	return nil
+}
+
+// IsTerminal reports whether a status has no way out
+func (m StateMachine) IsTerminal(status string) bool {
+	return len(m[status]) == 0
+}
+
+// StatusChange is who changed a status, why and when; it is recorded in
+// reservation_status_history with every transition
+type StatusChange struct {
+	Actor  string
+	Reason string
+	At     time.Time
+}
+
+// StatusHistoryEntry is one recorded transition
+type StatusHistoryEntry struct {
+	ID            int64     `json:"id"`
+	ReservationID int64     `json:"reservation_id"`
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	Actor         string    `json:"actor"`
+	Reason        *string   `json:"reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
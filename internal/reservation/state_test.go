@@ -0,0 +1,59 @@
+package reservation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransitions(t *testing.T) {
+	all := []string{StatusActive, StatusConfirmed, StatusCanceled, StatusExpired}
+
+	allowed := map[[2]string]bool{
+		{StatusActive, StatusConfirmed}: true,
+		{StatusActive, StatusCanceled}:  true,
+		{StatusActive, StatusExpired}:   true,
+	}
+
+	// каждая пара статусов, включая переход в себя и выход из терминальных
+	for _, from := range all {
+		for _, to := range all {
+			want := allowed[[2]string{from, to}]
+			t.Run(from+"->"+to, func(t *testing.T) {
+				if got := Transitions.Can(from, to); got != want {
+					t.Errorf("Can = %v, want %v", got, want)
+				}
+
+				err := Transitions.Check(from, to)
+				if want && err != nil {
+					t.Errorf("Check: %v, want nil", err)
+				}
+				if !want && !errors.Is(err, ErrInvalidTransition) {
+					t.Errorf("Check: %v, want ErrInvalidTransition", err)
+				}
+			})
+		}
+	}
+
+	// неизвестный статус никуда не ведёт
+	if Transitions.Can("UNKNOWN", StatusActive) || Transitions.Can(StatusActive, "UNKNOWN") {
+		t.Errorf("transition with an unknown status allowed")
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	tests := []struct {
+		status   string
+		terminal bool
+	}{
+		{StatusActive, false},
+		{StatusConfirmed, true},
+		{StatusCanceled, true},
+		{StatusExpired, true},
+		{"UNKNOWN", true},
+	}
+	for _, tt := range tests {
+		if got := Transitions.IsTerminal(tt.status); got != tt.terminal {
+			t.Errorf("IsTerminal(%s) = %v, want %v", tt.status, got, tt.terminal)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package reservation
+
+import "time"
+
+const (
+	WaitlistWaiting  = "WAITING"
+	WaitlistPromoted = "PROMOTED"
+	WaitlistCanceled = "CANCELED"
+)
+
+// WaitlistEntry is a user waiting for quantity units of a sold-out
+// product. Returned stock is offered to entries in id order; a promoted
+// entry points to the reservation it got.
+type WaitlistEntry struct {
+	ID            int64     `json:"id"`
+	ProductID     int64     `json:"product_id"`
+	UserID        int64     `json:"user_id"`
+	Quantity      int       `json:"quantity"`
+	Status        string    `json:"status"`
+	ReservationID *int64    `json:"reservation_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	// Position — сколько WAITING записей впереди, только для WAITING
+	Position *int `json:"position,omitempty"`
+}
@@ -0,0 +1,144 @@
+package reservation
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const waitlistColumns = `
+	id, product_id, user_id, quantity, status, reservation_id, created_at, updated_at
+`
+
+func scanWaitlistEntry(row rowScanner) (*WaitlistEntry, error) {
+	var e WaitlistEntry
+	if err := row.Scan(
+		&e.ID,
+		&e.ProductID,
+		&e.UserID,
+		&e.Quantity,
+		&e.Status,
+		&e.ReservationID,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// AddWaitlistEntryTx puts the user at the end of the product waitlist.
+// A user already waiting keeps their place and entry.
+func (r *Repository) AddWaitlistEntryTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	productID, userID int64,
+	quantity int,
+) (*WaitlistEntry, error) {
+
+	query := `
+		INSERT INTO waitlist_entries (product_id, user_id, quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (product_id, user_id) WHERE status = 'WAITING'
+		DO UPDATE SET updated_at = waitlist_entries.updated_at
+		RETURNING ` + waitlistColumns
+
+	return scanWaitlistEntry(tx.QueryRowContext(ctx, query, productID, userID, quantity))
+}
+
+// GetWaitlistEntry returns the entry with its position in the queue
+func (r *Repository) GetWaitlistEntry(ctx context.Context, id int64) (*WaitlistEntry, error) {
+
+	query := `
+		SELECT ` + waitlistColumns + `
+		FROM waitlist_entries
+		WHERE id = $1
+	`
+
+	e, err := scanWaitlistEntry(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+	if e.Status != WaitlistWaiting {
+		return e, nil
+	}
+
+	var ahead int
+	err = r.db.QueryRowContext(ctx, `
+		SELECT count(*)
+		FROM waitlist_entries
+		WHERE product_id = $1
+		  AND status = 'WAITING'
+		  AND id < $2
+	`, e.ProductID, e.ID).Scan(&ahead)
+	if err != nil {
+		return nil, err
+	}
+	e.Position = &ahead
+
+	return e, nil
+}
+
+// NextWaitingForUpdateTx locks the head of the product waitlist.
+// Returns sql.ErrNoRows when nobody is waiting.
+func (r *Repository) NextWaitingForUpdateTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	productID int64,
+) (*WaitlistEntry, error) {
+
+	query := `
+		SELECT ` + waitlistColumns + `
+		FROM waitlist_entries
+		WHERE product_id = $1
+		  AND status = 'WAITING'
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE
+	`
+
+	return scanWaitlistEntry(tx.QueryRowContext(ctx, query, productID))
+}
+
+// SetWaitlistStatusTx closes a WAITING entry as PROMOTED or CANCELED
+func (r *Repository) SetWaitlistStatusTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	id int64,
+	status string,
+	reservationID *int64,
+	at time.Time,
+) error {
+
+	query := `
+		UPDATE waitlist_entries
+		SET status = $2,
+		    reservation_id = $3,
+		    updated_at = $4
+		WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, id, status, reservationID, at)
+	return err
+}
+
+// CancelWaitlistEntry leaves the waitlist; false if the entry is no longer WAITING
+func (r *Repository) CancelWaitlistEntry(ctx context.Context, id int64, at time.Time) (bool, error) {
+
+	query := `
+		UPDATE waitlist_entries
+		SET status = 'CANCELED',
+		    updated_at = $2
+		WHERE id = $1
+		  AND status = 'WAITING'
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, at)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
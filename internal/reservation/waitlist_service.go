@@ -0,0 +1,235 @@
+package reservation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"flash-sale-reservation/internal/product"
+)
+
+// JoinWaitlist puts the user in line for a sold-out product. Stock returned
+// later by cancel or expiry is offered to the line in order (see
+// promoteWaitlistTx). Joining twice keeps the first entry.
+func (s *Service) JoinWaitlist(
+	ctx context.Context,
+	productID int64,
+	userID int64,
+	quantity int,
+) (*WaitlistEntry, error) {
+
+	if quantity <= 0 || quantity > MaxQuantity {
+		return nil, fmt.Errorf("%w: quantity must be between 1 and %d", ErrInvalidInput, MaxQuantity)
+	}
+	if userID <= 0 {
+		return nil, fmt.Errorf("%w: user_id must be > 0", ErrInvalidInput)
+	}
+
+	// с включённым gate Create отказывает по счётчику Redis, даже если в
+	// БД stock ещё есть (единицы держат запросы в полёте) — сверяемся с ним
+	gateStock, gated := s.gateAvailable(ctx, productID)
+
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// блокировка товара: promote не пропустит запись, вставленную после его проверки
+	p, err := s.productRepo.GetByIDForUpdateTx(ctx, tx, productID)
+	if err != nil {
+		return nil, notFound(err, "product", productID)
+	}
+
+	if err := p.CheckSaleWindow(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.checkNoRaffleTx(ctx, tx, productID); err != nil {
+		return nil, err
+	}
+	if p.Queued {
+		return nil, fmt.Errorf("%w: product is queued, join the waiting room instead", ErrInvalidInput)
+	}
+	stock := p.Stock
+	if gated {
+		stock = gateStock
+	}
+	if stock >= quantity {
+		return nil, fmt.Errorf("%w: product is in stock, reserve it directly", ErrInvalidInput)
+	}
+
+	hasActive, err := s.repo.HasActiveReservationTx(ctx, tx, productID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if hasActive {
+		return nil, ErrAlreadyReserved
+	}
+
+	e, err := s.repo.AddWaitlistEntryTx(ctx, tx, productID, userID, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetWaitlistEntry(ctx, e.ID, userID)
+}
+
+// GetWaitlistEntry returns userID's entry and, while it waits, its
+// position
+func (s *Service) GetWaitlistEntry(ctx context.Context, id, userID int64) (*WaitlistEntry, error) {
+	e, err := s.repo.GetWaitlistEntry(ctx, id)
+	if err != nil {
+		return nil, notFound(err, "waitlist entry", id)
+	}
+	if err := checkOwnedBy(e.UserID, userID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CancelWaitlistEntry takes a WAITING entry of userID out of line
+func (s *Service) CancelWaitlistEntry(ctx context.Context, id, userID int64) (*WaitlistEntry, error) {
+	// запись не меняет владельца, проверять до UPDATE достаточно
+	if _, err := s.GetWaitlistEntry(ctx, id, userID); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.repo.CancelWaitlistEntry(ctx, id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		e, err := s.GetWaitlistEntry(ctx, id, userID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: waitlist entry is %s, only WAITING can be canceled", ErrInvalidTransition, e.Status)
+	}
+
+	return s.GetWaitlistEntry(ctx, id, userID)
+}
+
+// promoteWaitlistTx offers stock just returned to a product to its
+// waitlist, turning entries into ACTIVE reservations in the caller's
+// transaction; the caller must hold the product row lock. Entries are
+// served strictly in order: promotion stops at the first one that wants
+// more than is left. An entry whose user already holds the product or
+// has hit a purchase limit is canceled and skipped.
+//
+// Returns the reservations created and the stock level after them.
+func (s *Service) promoteWaitlistTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	level product.StockLevel,
+	now time.Time,
+) ([]Reservation, product.StockLevel, error) {
+
+	if level.Stock <= 0 {
+		return nil, level, nil
+	}
+
+	p, err := s.productRepo.GetByIDTx(ctx, tx, level.ProductID)
+	if err != nil {
+		return nil, level, err
+	}
+
+	// вне окна распродажи и во время розыгрыша stock не раздаём
+	if p.CheckSaleWindow(now) != nil {
+		return nil, level, nil
+	}
+	open, err := s.repo.HasOpenRaffleTx(ctx, tx, p.ID)
+	if err != nil || open {
+		return nil, level, err
+	}
+
+	var promoted []Reservation
+	for level.Stock > 0 {
+		e, err := s.repo.NextWaitingForUpdateTx(ctx, tx, p.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, level, err
+		}
+		if e.Quantity > level.Stock {
+			break
+		}
+
+		hasActive, err := s.repo.HasActiveReservationTx(ctx, tx, p.ID, e.UserID)
+		if err != nil {
+			return nil, level, err
+		}
+		if hasActive {
+			if err := s.repo.SetWaitlistStatusTx(ctx, tx, e.ID, WaitlistCanceled, nil, now); err != nil {
+				return nil, level, err
+			}
+			continue
+		}
+
+		// ждать блокировку лимита нельзя: строка товара уже у нас, а
+		// держатель лимита может ждать именно её
+		items := []CartItem{{ProductID: p.ID, Quantity: e.Quantity}}
+		err = s.checkLimitsTx(ctx, tx, e.UserID, items, map[int64]*product.Product{p.ID: p}, false)
+		if errors.Is(err, errLimitBusy) {
+			break
+		}
+		if errors.Is(err, ErrLimitExceeded) {
+			if err := s.repo.SetWaitlistStatusTx(ctx, tx, e.ID, WaitlistCanceled, nil, now); err != nil {
+				return nil, level, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, level, err
+		}
+
+		level, err = s.productRepo.DecreaseStockTx(ctx, tx, p.ID, e.Quantity)
+		if err != nil {
+			return nil, level, err
+		}
+
+		res, err := s.repo.CreateTx(ctx, tx, p.ID, e.UserID, e.Quantity, now.Add(p.InitialHold(s.defaultHold)), nil)
+		if err != nil {
+			return nil, level, err
+		}
+
+		if err := s.repo.SetWaitlistStatusTx(ctx, tx, e.ID, WaitlistPromoted, &res.ID, now); err != nil {
+			return nil, level, err
+		}
+
+		if err := s.emitCreatedTx(ctx, tx, res, level.Stock); err != nil {
+			return nil, level, err
+		}
+		if err := s.emitWaitlistPromotedTx(ctx, tx, e, res, now); err != nil {
+			return nil, level, err
+		}
+
+		promoted = append(promoted, *res)
+	}
+
+	return promoted, level, nil
+}
+
+// afterPromotion does the Redis side of promoted reservations once the
+// transaction is committed and releases on the gate only the returned
+// units nobody from the waitlist took
+func (s *Service) afterPromotion(ctx context.Context, productID int64, returned int, promoted []Reservation) {
+	for _, res := range promoted {
+		_ = s.redis.Set(ctx, TTLKey(res.ID), "active", time.Until(res.ExpiresAt)).Err()
+		returned -= res.Quantity
+	}
+
+	if len(promoted) > 0 {
+		_ = s.redis.IncrBy(ctx, "metrics:reservations:created", int64(len(promoted))).Err()
+	}
+
+	if returned > 0 {
+		s.gateRelease(ctx, productID, returned)
+	}
+}
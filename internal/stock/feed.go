@@ -0,0 +1,231 @@
+// Package stock fans out live stock levels to SSE subscribers.
+//
+// Every instance publishes committed stock changes to one Redis channel
+// and listens to it, so a subscriber connected to any instance sees
+// changes made on all of them. Each update gets a global sequence number
+// (the SSE event id); the latest update per product is kept in Redis so a
+// reconnecting client can resume from Last-Event-ID.
+package stock
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+
+	"flash-sale-reservation/internal/product"
+)
+
+const (
+	channel     = "stock:updates"
+	seqKey      = "stock:seq"
+	levelsKey   = "stock:levels"
+	versionsKey = "stock:versions"
+
+	subscriberBuffer = 16
+)
+
+// Update is one stock level pushed to subscribers
+type Update struct {
+	ProductID int64 `json:"product_id"`
+	Stock     int   `json:"stock"`
+	Version   int64 `json:"version"`
+	// Seq — глобальный номер обновления, он же SSE id
+	Seq int64 `json:"seq"`
+}
+
+// publishScript drops updates older than the one already published for
+// the product: commits of concurrent transactions may reach Redis out of
+// order, and stock_version tells which one is newer.
+var publishScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or '-1')
+if tonumber(ARGV[3]) <= current then
+	return 0
+end
+local seq = redis.call('INCR', KEYS[3])
+local msg = cjson.encode({
+	product_id = tonumber(ARGV[1]),
+	stock = tonumber(ARGV[2]),
+	version = tonumber(ARGV[3]),
+	seq = seq
+})
+redis.call('HSET', KEYS[1], ARGV[1], msg)
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('PUBLISH', ARGV[4], msg)
+return seq
+`)
+
+type Feed struct {
+	redis       *redis.Client
+	productRepo *product.Repository
+
+	mu          sync.Mutex
+	subscribers map[int64]map[*Subscription]struct{}
+}
+
+func NewFeed(redis *redis.Client, productRepo *product.Repository) *Feed {
+	return &Feed{
+		redis:       redis,
+		productRepo: productRepo,
+		subscribers: make(map[int64]map[*Subscription]struct{}),
+	}
+}
+
+// Publish announces a committed stock level to every instance.
+// Call it only after the transaction that produced level has committed.
+func (f *Feed) Publish(ctx context.Context, level product.StockLevel) error {
+	return publishScript.Run(
+		ctx,
+		f.redis,
+		[]string{levelsKey, versionsKey, seqKey},
+		level.ProductID,
+		level.Stock,
+		level.Version,
+		channel,
+	).Err()
+}
+
+// Snapshots returns the latest known level of each product. Products that
+// were not published yet are read from PostgreSQL with Seq = 0.
+func (f *Feed) Snapshots(ctx context.Context, productIDs []int64) ([]Update, error) {
+	fields := make([]string, len(productIDs))
+	for i, id := range productIDs {
+		fields[i] = strconv.FormatInt(id, 10)
+	}
+
+	values, err := f.redis.HMGet(ctx, levelsKey, fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		snapshots []Update
+		missing   []int64
+	)
+	for i, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			missing = append(missing, productIDs[i])
+			continue
+		}
+
+		var u Update
+		if err := json.Unmarshal([]byte(raw), &u); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, u)
+	}
+
+	if len(missing) > 0 {
+		levels, err := f.productRepo.GetStockLevels(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range levels {
+			snapshots = append(snapshots, Update{
+				ProductID: l.ProductID,
+				Stock:     l.Stock,
+				Version:   l.Version,
+			})
+		}
+	}
+
+	return snapshots, nil
+}
+
+// Subscription receives updates for a set of products. C is closed when
+// the subscriber falls behind; the client is expected to reconnect with
+// Last-Event-ID and catch up from snapshots.
+type Subscription struct {
+	C          chan Update
+	productIDs []int64
+	closed     bool
+}
+
+func (f *Feed) Subscribe(productIDs []int64) *Subscription {
+	sub := &Subscription{
+		C:          make(chan Update, subscriberBuffer),
+		productIDs: productIDs,
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, id := range productIDs {
+		if f.subscribers[id] == nil {
+			f.subscribers[id] = make(map[*Subscription]struct{})
+		}
+		f.subscribers[id][sub] = struct{}{}
+	}
+
+	return sub
+}
+
+func (f *Feed) Unsubscribe(sub *Subscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.remove(sub)
+}
+
+// remove must be called with f.mu held
+func (f *Feed) remove(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+
+	for _, id := range sub.productIDs {
+		delete(f.subscribers[id], sub)
+		if len(f.subscribers[id]) == 0 {
+			delete(f.subscribers, id)
+		}
+	}
+	close(sub.C)
+}
+
+// Run listens to the Redis channel and dispatches updates to local
+// subscribers until ctx is canceled.
+func (f *Feed) Run(ctx context.Context) {
+	pubsub := f.redis.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	log.Printf("stock feed subscribed to %s", channel)
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("stock feed stopped")
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			var u Update
+			if err := json.Unmarshal([]byte(msg.Payload), &u); err != nil {
+				log.Printf("stock feed: bad message %q: %v", msg.Payload, err)
+				continue
+			}
+			f.dispatch(u)
+		}
+	}
+}
+
+func (f *Feed) dispatch(u Update) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for sub := range f.subscribers[u.ProductID] {
+		select {
+		case sub.C <- u:
+		default:
+			// медленный клиент — отключаем, он переподключится с Last-Event-ID
+			f.remove(sub)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+-- =========================
+-- EXPIRY SWEEP
+-- =========================
+-- Sweeper выбирает ACTIVE резервы по expires_at батчами
+CREATE INDEX ix_reservations_active_expires_at
+    ON reservations (expires_at)
+    WHERE status = 'ACTIVE';
@@ -0,0 +1,21 @@
+-- =========================
+-- OUTBOX RELAY
+-- =========================
+-- published_at     — событие доставлено
+-- attempts         — сколько раз пытались опубликовать
+-- next_attempt_at  — раньше этого времени не ретраим (backoff)
+-- dead_lettered_at — poison-событие, relay его больше не трогает
+ALTER TABLE outbox_events
+    ADD COLUMN published_at     TIMESTAMP,
+    ADD COLUMN attempts         INTEGER   NOT NULL DEFAULT 0,
+    ADD COLUMN next_attempt_at  TIMESTAMP NOT NULL DEFAULT now(),
+    ADD COLUMN last_error       TEXT,
+    ADD COLUMN dead_lettered_at TIMESTAMP;
+
+CREATE INDEX ix_outbox_events_pending
+    ON outbox_events (id)
+    WHERE published_at IS NULL AND dead_lettered_at IS NULL;
+
+CREATE INDEX ix_outbox_events_dead
+    ON outbox_events (id)
+    WHERE dead_lettered_at IS NOT NULL;
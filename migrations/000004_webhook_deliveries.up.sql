@@ -0,0 +1,21 @@
+-- =========================
+-- WEBHOOK DELIVERIES
+-- =========================
+-- Лог каждой попытки доставки outbox-события подписчику
+CREATE TABLE webhook_deliveries (
+                                    id          BIGSERIAL PRIMARY KEY,
+                                    event_id    BIGINT    NOT NULL REFERENCES outbox_events(id),
+                                    event_type  TEXT      NOT NULL,
+                                    url         TEXT      NOT NULL,
+                                    attempt     INTEGER   NOT NULL,
+                                    status_code INTEGER,
+                                    error       TEXT,
+                                    succeeded   BOOLEAN   NOT NULL,
+                                    duration_ms INTEGER   NOT NULL,
+                                    created_at  TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- повторная публикация события пропускает подписчиков, которым уже доставлено
+CREATE INDEX ix_webhook_deliveries_succeeded
+    ON webhook_deliveries (event_id, url)
+    WHERE succeeded;
@@ -0,0 +1,7 @@
+-- =========================
+-- STOCK VERSION
+-- =========================
+-- Растёт при каждом изменении stock; по нему SSE-поток отбрасывает
+-- устаревшие обновления, пришедшие не по порядку
+ALTER TABLE products
+    ADD COLUMN stock_version BIGINT NOT NULL DEFAULT 0;
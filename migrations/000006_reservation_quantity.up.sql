@@ -0,0 +1,6 @@
+-- =========================
+-- RESERVATION QUANTITY
+-- =========================
+-- Резерв может держать несколько единиц товара (наборы, упаковки)
+ALTER TABLE reservations
+    ADD COLUMN quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0);
@@ -0,0 +1,18 @@
+-- =========================
+-- CARTS
+-- =========================
+-- Корзина — несколько резервов (строк), созданных одной транзакцией
+-- с общим expires_at; подтверждается и отменяется целиком
+CREATE TABLE carts (
+                       id         BIGSERIAL PRIMARY KEY,
+                       user_id    BIGINT    NOT NULL,
+                       expires_at TIMESTAMP NOT NULL,
+                       created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+ALTER TABLE reservations
+    ADD COLUMN cart_id BIGINT REFERENCES carts(id);
+
+CREATE INDEX ix_reservations_cart_id
+    ON reservations (cart_id)
+    WHERE cart_id IS NOT NULL;
@@ -0,0 +1,20 @@
+-- =========================
+-- IDEMPOTENCY KEYS
+-- =========================
+-- Ответы на запросы с заголовком Idempotency-Key.
+-- scope — метод и путь запроса, fingerprint — sha256 метода, пути и тела
+CREATE TABLE idempotency_keys (
+                                  scope           TEXT      NOT NULL,
+                                  key             TEXT      NOT NULL,
+                                  fingerprint     TEXT      NOT NULL,
+                                  status          TEXT      NOT NULL,
+                                  response_status INTEGER,
+                                  content_type    TEXT,
+                                  response_body   BYTEA,
+                                  created_at      TIMESTAMP NOT NULL DEFAULT now(),
+                                  completed_at    TIMESTAMP,
+                                  PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX ix_idempotency_keys_created_at
+    ON idempotency_keys (created_at);
@@ -0,0 +1,13 @@
+-- =========================
+-- HOLD POLICY
+-- =========================
+-- hold_seconds     — длительность резерва товара (NULL — глобальный HOLD_DURATION)
+-- max_extensions   — сколько раз резерв можно продлить
+-- max_hold_seconds — предел общей длительности резерва с продлениями (от created_at)
+ALTER TABLE products
+    ADD COLUMN hold_seconds     INTEGER CHECK (hold_seconds > 0),
+    ADD COLUMN max_extensions   INTEGER NOT NULL DEFAULT 0 CHECK (max_extensions >= 0),
+    ADD COLUMN max_hold_seconds INTEGER CHECK (max_hold_seconds > 0);
+
+ALTER TABLE reservations
+    ADD COLUMN extensions INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+-- =========================
+-- SALE WINDOW
+-- =========================
+-- starts_at — с какого момента принимаются резервы (NULL — сразу)
+-- ends_at   — когда распродажа заканчивается (NULL — без конца);
+--             оставшиеся ACTIVE резервы после ends_at отменяются
+ALTER TABLE products
+    ADD COLUMN starts_at TIMESTAMP,
+    ADD COLUMN ends_at   TIMESTAMP,
+    ADD CONSTRAINT products_sale_window_check
+        CHECK (starts_at IS NULL OR ends_at IS NULL OR ends_at > starts_at);
+
+CREATE INDEX ix_products_ends_at
+    ON products (ends_at)
+    WHERE ends_at IS NOT NULL;
@@ -0,0 +1,25 @@
+-- =========================
+-- PURCHASE LIMITS
+-- =========================
+-- Кампания — набор товаров с общим лимитом единиц на пользователя
+CREATE TABLE campaigns (
+                           id           BIGSERIAL PRIMARY KEY,
+                           name         TEXT      NOT NULL,
+                           max_per_user INTEGER   NOT NULL CHECK (max_per_user > 0),
+                           created_at   TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- max_per_user — сколько единиц товара пользователь может держать
+-- в ACTIVE и CONFIRMED резервах (NULL — без лимита)
+ALTER TABLE products
+    ADD COLUMN max_per_user INTEGER CHECK (max_per_user > 0),
+    ADD COLUMN campaign_id  BIGINT REFERENCES campaigns(id);
+
+CREATE INDEX ix_products_campaign_id
+    ON products (campaign_id)
+    WHERE campaign_id IS NOT NULL;
+
+-- подсчёт уже взятого пользователем при проверке лимитов
+CREATE INDEX ix_reservations_user_held
+    ON reservations (user_id, product_id)
+    WHERE status IN ('ACTIVE', 'CONFIRMED');
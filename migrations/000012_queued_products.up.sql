@@ -0,0 +1,6 @@
+-- =========================
+-- WAITING ROOM
+-- =========================
+-- queued = true — резерв товара только по пропущенному токену очереди
+ALTER TABLE products
+    ADD COLUMN queued BOOLEAN NOT NULL DEFAULT false;
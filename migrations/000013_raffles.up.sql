@@ -0,0 +1,37 @@
+-- =========================
+-- RAFFLES
+-- =========================
+-- Розыгрыш вместо «кто первый»: пользователи регистрируются до
+-- registration_ends_at, затем случайный порядок участников считается
+-- из seed; победители по порядку получают ACTIVE резервы, пока хватает stock.
+-- seed_hash публикуется сразу, seed — только после розыгрыша.
+CREATE TABLE raffles (
+                         id                   BIGSERIAL PRIMARY KEY,
+                         product_id           BIGINT    NOT NULL REFERENCES products(id),
+                         quantity             INTEGER   NOT NULL DEFAULT 1 CHECK (quantity > 0),
+                         registration_ends_at TIMESTAMP NOT NULL,
+                         status               TEXT      NOT NULL DEFAULT 'OPEN'
+                             CHECK (status IN ('OPEN', 'DRAWN')),
+                         seed                 TEXT      NOT NULL,
+                         seed_hash            TEXT      NOT NULL,
+                         winners              INTEGER,
+                         drawn_at             TIMESTAMP,
+                         created_at           TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- не больше одного открытого розыгрыша на товар
+CREATE UNIQUE INDEX ux_raffles_open_product
+    ON raffles (product_id)
+    WHERE status = 'OPEN';
+
+-- result: WON — получил резерв, LOST — не выпал,
+-- FORFEITED — выпал, но уже держал ACTIVE резерв товара
+CREATE TABLE raffle_entries (
+                                raffle_id      BIGINT    NOT NULL REFERENCES raffles(id),
+                                user_id        BIGINT    NOT NULL,
+                                result         TEXT
+                                    CHECK (result IN ('WON', 'LOST', 'FORFEITED')),
+                                reservation_id BIGINT REFERENCES reservations(id),
+                                created_at     TIMESTAMP NOT NULL DEFAULT now(),
+                                PRIMARY KEY (raffle_id, user_id)
+);
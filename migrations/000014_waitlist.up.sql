@@ -0,0 +1,26 @@
+-- =========================
+-- WAITLIST
+-- =========================
+-- Очередь ожидания товара: вернувшийся stock (отмена, истечение)
+-- в той же транзакции отдаётся ожидающим по порядку id как новые резервы
+CREATE TABLE waitlist_entries (
+                                  id             BIGSERIAL PRIMARY KEY,
+                                  product_id     BIGINT    NOT NULL REFERENCES products(id),
+                                  user_id        BIGINT    NOT NULL,
+                                  quantity       INTEGER   NOT NULL CHECK (quantity > 0),
+                                  status         TEXT      NOT NULL DEFAULT 'WAITING'
+                                      CHECK (status IN ('WAITING', 'PROMOTED', 'CANCELED')),
+                                  reservation_id BIGINT REFERENCES reservations(id),
+                                  created_at     TIMESTAMP NOT NULL DEFAULT now(),
+                                  updated_at     TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- одна ожидающая запись на (товар, пользователь)
+CREATE UNIQUE INDEX ux_waitlist_waiting
+    ON waitlist_entries (product_id, user_id)
+    WHERE status = 'WAITING';
+
+-- голова очереди товара
+CREATE INDEX ix_waitlist_entries_head
+    ON waitlist_entries (product_id, id)
+    WHERE status = 'WAITING';
@@ -0,0 +1,27 @@
+-- =========================
+-- RESERVATION STATUS
+-- =========================
+-- Статусы резерва — те же, что в reservation.Transitions
+ALTER TABLE reservations
+    ADD CONSTRAINT reservations_status_check
+        CHECK (status IN ('ACTIVE', 'CONFIRMED', 'CANCELED', 'EXPIRED'));
+
+-- =========================
+-- RESERVATION STATUS HISTORY
+-- =========================
+-- Каждая смена статуса через Repository.UpdateStatusTx / UpdateStatusBatchTx
+-- actor  — кто изменил: user, admin, system
+-- reason — почему (необязательно)
+CREATE TABLE reservation_status_history (
+                                            id             BIGSERIAL PRIMARY KEY,
+                                            reservation_id BIGINT    NOT NULL REFERENCES reservations(id),
+                                            from_status    TEXT      NOT NULL,
+                                            to_status      TEXT      NOT NULL,
+                                            actor          TEXT      NOT NULL
+                                                CHECK (actor IN ('user', 'admin', 'system')),
+                                            reason         TEXT,
+                                            created_at     TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ix_reservation_status_history_reservation
+    ON reservation_status_history (reservation_id, id);
@@ -0,0 +1,10 @@
+-- =========================
+-- CANCEL REASON
+-- =========================
+-- Почему и кем отменён резерв; заполняется при переходе в CANCELED.
+-- У резервов, отменённых до этой миграции, — NULL
+ALTER TABLE reservations
+    ADD COLUMN cancel_reason TEXT
+        CHECK (cancel_reason IN ('user_changed_mind', 'payment_failed', 'fraud', 'admin_override', 'sale_ended')),
+    ADD COLUMN canceled_by   TEXT
+        CHECK (canceled_by IN ('user', 'admin', 'system'));
@@ -0,0 +1,40 @@
+-- =========================
+-- API KEYS
+-- =========================
+-- Ключи для /admin, POST /products и т.п. Сам ключ не хранится —
+-- только SHA-256 (key_hash); prefix — первые символы для узнавания в списке.
+-- scopes — products:write, reservations:admin, outbox:replay, apikeys:admin
+CREATE TABLE api_keys (
+                          id           BIGSERIAL PRIMARY KEY,
+                          name         TEXT      NOT NULL,
+                          prefix       TEXT      NOT NULL,
+                          key_hash     TEXT      NOT NULL,
+                          scopes       TEXT[]    NOT NULL,
+                          rotated_from BIGINT REFERENCES api_keys(id),
+                          created_at   TIMESTAMP NOT NULL DEFAULT now(),
+                          expires_at   TIMESTAMP,
+                          revoked_at   TIMESTAMP,
+                          last_used_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX ux_api_keys_key_hash
+    ON api_keys (key_hash);
+
+-- =========================
+-- ADMIN AUDIT LOG
+-- =========================
+-- Каждый вызов маршрута под API-ключом, включая отказы (401/403).
+-- api_key_id пуст, если ключ не передан или не найден.
+CREATE TABLE admin_audit_log (
+                                 id          BIGSERIAL PRIMARY KEY,
+                                 api_key_id  BIGINT REFERENCES api_keys(id),
+                                 scope       TEXT      NOT NULL,
+                                 method      TEXT      NOT NULL,
+                                 path        TEXT      NOT NULL,
+                                 status      INTEGER   NOT NULL,
+                                 remote_addr TEXT      NOT NULL,
+                                 created_at  TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ix_admin_audit_log_created
+    ON admin_audit_log (created_at);
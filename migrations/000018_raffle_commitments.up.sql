@@ -0,0 +1,27 @@
+-- =========================
+-- RAFFLE COMMITMENTS
+-- =========================
+-- seed больше не хранится до розыгрыша: он выводится из RAFFLE_SEED_SECRET
+-- и seed_nonce (HMAC), в таблице до DRAWN — только seed_hash и nonce.
+-- seed записывается при розыгрыше, когда его и так публикуют.
+-- Розыгрыши с хранимым seed не выпускались, поэтому seed_nonce NOT NULL.
+--
+-- OPEN → CLOSED → DRAWN: при закрытии регистрации фиксируется набор
+-- участников — entrants_hash (SHA-256 отсортированных user_id), он
+-- публикуется до того, как раскрыт seed.
+ALTER TABLE raffles
+    ALTER COLUMN seed DROP NOT NULL,
+    ADD COLUMN seed_nonce    TEXT NOT NULL,
+    ADD COLUMN entrants_hash TEXT,
+    ADD COLUMN closed_at     TIMESTAMP;
+
+ALTER TABLE raffles
+    DROP CONSTRAINT raffles_status_check,
+    ADD CONSTRAINT raffles_status_check
+        CHECK (status IN ('OPEN', 'CLOSED', 'DRAWN'));
+
+-- товар занят розыгрышем, пока тот не разыгран
+DROP INDEX ux_raffles_open_product;
+CREATE UNIQUE INDEX ux_raffles_open_product
+    ON raffles (product_id)
+    WHERE status IN ('OPEN', 'CLOSED');
@@ -0,0 +1,7 @@
+-- =========================
+-- API KEY SUCCESSOR
+-- =========================
+-- У ключа не больше одной замены: повторная ротация ключа, который уже
+-- в grace-периоде, скопировала бы его укороченный expires_at в новый ключ.
+CREATE UNIQUE INDEX ux_api_keys_rotated_from
+    ON api_keys (rotated_from);